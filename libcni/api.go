@@ -18,10 +18,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/types"
@@ -53,29 +54,48 @@ type RuntimeConf struct {
 	// to the plugin
 	CapabilityArgs map[string]interface{}
 
-	// DEPRECATED. Will be removed in a future release.
+	// DEPRECATED. Will be removed in a future release. It is ignored if the
+	// CNIConfig was given a cache directory or a CacheStore.
 	CacheDir string
 }
 
 type NetworkConfig struct {
 	Network *types.NetConf
-	Bytes   []byte
+	// ExecTimeout, if non-zero, limits how long each invocation of the
+	// plugin may run. It is read from the "execTimeout" key.
+	ExecTimeout time.Duration
+	Bytes       []byte
 }
 
 type NetworkConfigList struct {
-	Name         string
-	CNIVersion   string
+	Name       string
+	CNIVersion string
+	// CNIVersions are the versions acceptable to the list when its
+	// version is negotiated, read from the "cniVersions" key of the list
+	CNIVersions  []string
 	DisableCheck bool
-	Plugins      []*NetworkConfig
-	Bytes        []byte
+	// ExecTimeout is the default ExecTimeout of the plugins in the list.
+	// It is read from the "execTimeout" key of the list, and applied to
+	// the plugins that do not set their own when the list is parsed; a
+	// plugin that sets "0s" runs without a timeout.
+	ExecTimeout time.Duration
+	Plugins     []*NetworkConfig
+	Bytes       []byte
 }
 
 type CNI interface {
 	AddNetworkList(ctx context.Context, net *NetworkConfigList, rt *RuntimeConf) (types.Result, error)
 	CheckNetworkList(ctx context.Context, net *NetworkConfigList, rt *RuntimeConf) error
 	DelNetworkList(ctx context.Context, net *NetworkConfigList, rt *RuntimeConf) error
+	CheckNetworkListFromCache(ctx context.Context, netName string, rt *RuntimeConf) error
+	DelNetworkListFromCache(ctx context.Context, netName string, rt *RuntimeConf) error
+	AddNetworkLists(ctx context.Context, nets []*NetworkConfigList, rt *RuntimeConf, workers int) (map[string]types.Result, error)
+	DelNetworkLists(ctx context.Context, nets []*NetworkConfigList, rt *RuntimeConf, workers int) error
+	GCNetworkList(ctx context.Context, net *NetworkConfigList) error
+	GetStatusNetworkList(ctx context.Context, net *NetworkConfigList) ([]*PluginStatus, error)
 	GetNetworkListCachedResult(net *NetworkConfigList, rt *RuntimeConf) (types.Result, error)
 	GetNetworkListCachedConfig(net *NetworkConfigList, rt *RuntimeConf) ([]byte, *RuntimeConf, error)
+	ListCachedAttachments(netName, containerID string) ([]*CachedAttachment, error)
 
 	AddNetwork(ctx context.Context, net *NetworkConfig, rt *RuntimeConf) (types.Result, error)
 	CheckNetwork(ctx context.Context, net *NetworkConfig, rt *RuntimeConf) error
@@ -88,14 +108,125 @@ type CNI interface {
 }
 
 type CNIConfig struct {
-	Path     []string
-	exec     invoke.Exec
-	cacheDir string
+	Path []string
+
+	// RollbackOnFailure makes AddNetworkList tear down the plugins that
+	// already succeeded when a later plugin in the list fails, by running
+	// DEL on them in reverse order.
+	RollbackOnFailure bool
+
+	// RemoveCacheOnDelFailure makes DelNetworkList remove the cached result
+	// and configuration of an attachment even when some of the plugins
+	// failed. By default they are kept, so that the DEL can be retried with
+	// the same prevResult.
+	RemoveCacheOnDelFailure bool
+
+	// Retry, if set, makes plugins that fail with types.ErrTryAgainLater
+	// run again according to the policy.
+	Retry *RetryPolicy
+
+	// Observer, if set, is notified before and after every plugin
+	// invocation. Use MultiObserver to notify several observers.
+	Observer InvocationObserver
+
+	// Journal, if set, records each ADD and DEL operation while it runs,
+	// along with the plugins that have completed, so that operations
+	// interrupted by a crash of the runtime can be finished or undone with
+	// RecoverJournal. A DirCacheStore in a directory next to the results
+	// cache is a typical choice.
+	Journal CacheStore
+
+	// PluginCache, if set, keeps where plugins were found in Path and the
+	// versions they support, instead of searching Path and running VERSION
+	// every time a plugin is used.
+	PluginCache *PluginCache
+
+	// NegotiateVersions makes AddNetworkList, CheckNetworkList,
+	// DelNetworkList and ValidateNetworkList run a list's plugins with the
+	// version chosen by NegotiateVersion instead of the list's cniVersion.
+	// Results are still returned in the list's cniVersion.
+	NegotiateVersions bool
+
+	exec       invoke.Exec
+	cacheDir   string
+	cacheStore CacheStore
 }
 
 // CNIConfig implements the CNI interface
 var _ CNI = &CNIConfig{}
 
+// RollbackError is returned by AddNetworkList when RollbackOnFailure is set
+// and a plugin failed after earlier plugins in the list had succeeded. Err is
+// the original ADD failure; CleanupErrors holds any errors returned by the
+// plugins while they were being torn down.
+type RollbackError struct {
+	Err           error
+	CleanupErrors []error
+}
+
+func (e *RollbackError) Error() string {
+	if len(e.CleanupErrors) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v; rollback failed: %v", e.Err, e.CleanupErrors)
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// ListPluginError is a failure of one of the plugins of a list, identified
+// by its index in the list and its type
+type ListPluginError struct {
+	Index int
+	Type  string
+	Err   error
+}
+
+func (e *ListPluginError) Error() string {
+	return fmt.Sprintf("plugin %d (type %q): %v", e.Index, e.Type, e.Err)
+}
+
+func (e *ListPluginError) Unwrap() error {
+	return e.Err
+}
+
+// DelError is returned by DelNetworkList when any of the plugins of the list
+// failed; the other plugins were still run. Errors holds the failures in the
+// order the plugins were run, which is the reverse of the list, as
+// *ListPluginError, followed by any failure to record the progress of the
+// DEL in the journal.
+//
+// The error a plugin returned, such as a *types.Error, is the Err of its
+// *ListPluginError. Unwrap returns the first failure, so the error of the
+// first plugin that failed is reached by unwrapping twice.
+type DelError struct {
+	Errors []error
+}
+
+func (e *DelError) Error() string {
+	return fmt.Sprintf("%v", e.Errors)
+}
+
+// Unwrap returns the first failure
+func (e *DelError) Unwrap() error {
+	return e.Errors[0]
+}
+
+// Code returns the code of the first failure that a plugin returned as a
+// *types.Error, or types.ErrUnknown if there is none
+func (e *DelError) Code() uint {
+	for _, err := range e.Errors {
+		if perr, ok := err.(*ListPluginError); ok {
+			err = perr.Err
+		}
+		if terr, ok := err.(*types.Error); ok {
+			return terr.Code
+		}
+	}
+	return types.ErrUnknown
+}
+
 // NewCNIConfig returns a new CNIConfig object that will search for plugins
 // in the given paths and use the given exec interface to run those plugins,
 // or if the exec interface is not given, will use a default exec handler.
@@ -115,6 +246,21 @@ func NewCNIConfigWithCacheDir(path []string, cacheDir string, exec invoke.Exec)
 	}
 }
 
+// NewCNIConfigWithCacheStore returns a new CNIConfig object that will search
+// for plugins in the given paths use the given exec interface to run those
+// plugins, or if the exec interface is not given, will use a default exec
+// handler. The given cache store will be used for data that must be kept
+// between operations on the same attachment, and takes precedence over the
+// deprecated RuntimeConf.CacheDir, which is ignored. If store is nil, the
+// default cache directory is used as by NewCNIConfig.
+func NewCNIConfigWithCacheStore(path []string, store CacheStore, exec invoke.Exec) *CNIConfig {
+	return &CNIConfig{
+		Path:       path,
+		cacheStore: store,
+		exec:       exec,
+	}
+}
+
 func buildOneConfig(name, cniVersion string, orig *NetworkConfig, prevResult types.Result, rt *RuntimeConf) (*NetworkConfig, error) {
 	var err error
 
@@ -171,6 +317,11 @@ func injectRuntimeConfig(orig *NetworkConfig, rt *RuntimeConf) (*NetworkConfig,
 	return orig, nil
 }
 
+// findInPath finds a plugin in the path, through the plugin cache if any
+func (c *CNIConfig) findInPath(plugin string) (string, error) {
+	return c.PluginCache.findInPath(c.ensureExec(), plugin, c.Path)
+}
+
 // ensure we have a usable exec if the CNIConfig was not given one
 func (c *CNIConfig) ensureExec() invoke.Exec {
 	if c.exec == nil {
@@ -192,6 +343,9 @@ type cachedInfo struct {
 	CapabilityArgs map[string]interface{} `json:"capabilityArgs,omitempty"`
 	RawResult      map[string]interface{} `json:"result,omitempty"`
 	Result         types.Result           `json:"-"`
+
+	// key is the key of the entry in the CacheStore
+	key string
 }
 
 // getCacheDir returns the cache directory in this order:
@@ -208,11 +362,22 @@ func (c *CNIConfig) getCacheDir(rt *RuntimeConf) string {
 	return CacheDir
 }
 
-func (c *CNIConfig) getCacheFilePath(netName string, rt *RuntimeConf) (string, error) {
+// getCacheStore returns the CacheStore given to the CNIConfig object, or
+// falls back to the "results" directory of the cache directory. A given
+// CacheStore takes precedence over rt.CacheDir, as a cache directory given
+// to the CNIConfig object does in getCacheDir.
+func (c *CNIConfig) getCacheStore(rt *RuntimeConf) CacheStore {
+	if c.cacheStore != nil {
+		return c.cacheStore
+	}
+	return NewDirCacheStore(filepath.Join(c.getCacheDir(rt), "results"))
+}
+
+func getCacheKey(netName string, rt *RuntimeConf) (string, error) {
 	if netName == "" || rt.ContainerID == "" || rt.IfName == "" {
 		return "", fmt.Errorf("cache file path requires network name (%q), container ID (%q), and interface name (%q)", netName, rt.ContainerID, rt.IfName)
 	}
-	return filepath.Join(c.getCacheDir(rt), "results", fmt.Sprintf("%s-%s-%s", netName, rt.ContainerID, rt.IfName)), nil
+	return fmt.Sprintf("%s-%s-%s", netName, rt.ContainerID, rt.IfName), nil
 }
 
 func (c *CNIConfig) cacheAdd(result types.Result, config []byte, netName string, rt *RuntimeConf) error {
@@ -243,34 +408,54 @@ func (c *CNIConfig) cacheAdd(result types.Result, config []byte, netName string,
 		return err
 	}
 
-	fname, err := c.getCacheFilePath(netName, rt)
+	key, err := getCacheKey(netName, rt)
 	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
-		return err
-	}
 
-	return ioutil.WriteFile(fname, newBytes, 0600)
+	return c.getCacheStore(rt).Put(key, newBytes)
 }
 
 func (c *CNIConfig) cacheDel(netName string, rt *RuntimeConf) error {
-	fname, err := c.getCacheFilePath(netName, rt)
+	key, err := getCacheKey(netName, rt)
 	if err != nil {
 		// Ignore error
 		return nil
 	}
-	return os.Remove(fname)
+	return c.getCacheStore(rt).Delete(key)
+}
+
+// lockAttachment serializes operations on the attachment of a container
+// interface to a network, and returns a function that releases the lock
+func (c *CNIConfig) lockAttachment(ctx context.Context, netName string, rt *RuntimeConf) (func(), error) {
+	key, err := getCacheKey(netName, rt)
+	if err != nil || utils.ValidateContainerID(rt.ContainerID) != nil ||
+		utils.ValidateNetworkName(netName) != nil || utils.ValidateInterfaceName(rt.IfName) != nil {
+		// Operations on invalid attachments fail validation later on
+		return func() {}, nil
+	}
+	if locker, ok := c.getCacheStore(rt).(CacheLocker); ok {
+		unlock, err := locker.Lock(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock network %q attachment: %v", netName, err)
+		}
+		return unlock, nil
+	}
+	unlock, err := attachmentLocks.lock(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock network %q attachment: %v", netName, err)
+	}
+	return unlock, nil
 }
 
 func (c *CNIConfig) getCachedConfig(netName string, rt *RuntimeConf) ([]byte, *RuntimeConf, error) {
 	var bytes []byte
 
-	fname, err := c.getCacheFilePath(netName, rt)
+	key, err := getCacheKey(netName, rt)
 	if err != nil {
 		return nil, nil, err
 	}
-	bytes, err = ioutil.ReadFile(fname)
+	bytes, err = c.getCacheStore(rt).Get(key)
 	if err != nil {
 		// Ignore read errors; the cached result may not exist on-disk
 		return nil, nil, nil
@@ -294,11 +479,11 @@ func (c *CNIConfig) getCachedConfig(netName string, rt *RuntimeConf) ([]byte, *R
 }
 
 func (c *CNIConfig) getLegacyCachedResult(netName, cniVersion string, rt *RuntimeConf) (types.Result, error) {
-	fname, err := c.getCacheFilePath(netName, rt)
+	key, err := getCacheKey(netName, rt)
 	if err != nil {
 		return nil, err
 	}
-	data, err := ioutil.ReadFile(fname)
+	data, err := c.getCacheStore(rt).Get(key)
 	if err != nil {
 		// Ignore read errors; the cached result may not exist on-disk
 		return nil, nil
@@ -329,11 +514,11 @@ func (c *CNIConfig) getLegacyCachedResult(netName, cniVersion string, rt *Runtim
 }
 
 func (c *CNIConfig) getCachedResult(netName, cniVersion string, rt *RuntimeConf) (types.Result, error) {
-	fname, err := c.getCacheFilePath(netName, rt)
+	key, err := getCacheKey(netName, rt)
 	if err != nil {
 		return nil, err
 	}
-	fdata, err := ioutil.ReadFile(fname)
+	fdata, err := c.getCacheStore(rt).Get(key)
 	if err != nil {
 		// Ignore read errors; the cached result may not exist on-disk
 		return nil, nil
@@ -385,6 +570,83 @@ func (c *CNIConfig) GetNetworkCachedResult(net *NetworkConfig, rt *RuntimeConf)
 	return c.getCachedResult(net.Network.Name, net.Network.CNIVersion, rt)
 }
 
+// CacheReadError is returned by ListCachedAttachments, along with the
+// attachments it could read, when some entries of the results cache could
+// not be read. Errors maps the keys of those entries to their error.
+type CacheReadError struct {
+	Errors map[string]error
+}
+
+func (e *CacheReadError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	errs := make([]error, 0, len(keys))
+	for _, key := range keys {
+		errs = append(errs, fmt.Errorf("cache entry %q: %v", key, e.Errors[key]))
+	}
+	return fmt.Sprintf("failed to read results cache entries: %v", errs)
+}
+
+// cacheKeyMayMatch reports whether the entry with the given key may be for
+// network netName and container containerID, if they are not empty. The
+// parts of a key cannot be told apart reliably, so keys of other networks
+// and containers may match too.
+func cacheKeyMayMatch(key, netName, containerID string) bool {
+	if netName != "" && !strings.HasPrefix(key, netName+"-") {
+		return false
+	}
+	if containerID != "" && !strings.Contains(key, "-"+containerID+"-") {
+		return false
+	}
+	return true
+}
+
+// ListCachedAttachments returns the attachments recorded in the results
+// cache by previous AddNetworkList() and AddNetwork() operations. If netName
+// or containerID are not empty, only attachments matching them are returned.
+//
+// If some entries cannot be read, the attachments that could be read are
+// returned along with a *CacheReadError naming the other entries; entries
+// whose result cannot be parsed are returned without a Result. Unreadable
+// entries are reported if their key may be for netName and containerID.
+func (c *CNIConfig) ListCachedAttachments(netName, containerID string) ([]*CachedAttachment, error) {
+	infos, badEntries, err := c.readCachedInfos()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results cache: %v", err)
+	}
+
+	readErr := &CacheReadError{Errors: map[string]error{}}
+	for key, err := range badEntries {
+		if cacheKeyMayMatch(key, netName, containerID) {
+			readErr.Errors[key] = err
+		}
+	}
+
+	attachments := []*CachedAttachment{}
+	for _, info := range infos {
+		if netName != "" && info.NetworkName != netName {
+			continue
+		}
+		if containerID != "" && info.ContainerID != containerID {
+			continue
+		}
+		att, err := newCachedAttachment(info)
+		if err != nil {
+			readErr.Errors[info.key] = fmt.Errorf("failed to parse cached result: %v", err)
+		}
+		attachments = append(attachments, att)
+	}
+
+	if len(readErr.Errors) > 0 {
+		return attachments, readErr
+	}
+	return attachments, nil
+}
+
 // GetNetworkListCachedConfig copies the input RuntimeConf to output
 // RuntimeConf with fields updated with info from the cached Config.
 func (c *CNIConfig) GetNetworkListCachedConfig(list *NetworkConfigList, rt *RuntimeConf) ([]byte, *RuntimeConf, error) {
@@ -397,9 +659,191 @@ func (c *CNIConfig) GetNetworkCachedConfig(net *NetworkConfig, rt *RuntimeConf)
 	return c.getCachedConfig(net.Network.Name, rt)
 }
 
+// CachedAttachment describes one entry in the results cache, which
+// corresponds to a single container interface attached to a network.
+type CachedAttachment struct {
+	NetworkName string
+	ContainerID string
+	IfName      string
+	// Config is the network configuration or configuration list that
+	// was used to add the attachment
+	Config         []byte
+	CniArgs        [][2]string
+	CapabilityArgs map[string]interface{}
+	// Result is the result of the ADD operation, in the CNI version
+	// it was cached in
+	Result types.Result
+}
+
+// newCachedAttachment converts a cache entry into a CachedAttachment. If the
+// cached result cannot be parsed, the attachment is returned without a
+// Result along with the error.
+func newCachedAttachment(info *cachedInfo) (*CachedAttachment, error) {
+	att := &CachedAttachment{
+		NetworkName:    info.NetworkName,
+		ContainerID:    info.ContainerID,
+		IfName:         info.IfName,
+		Config:         info.Config,
+		CniArgs:        info.CniArgs,
+		CapabilityArgs: info.CapabilityArgs,
+	}
+	if info.RawResult == nil {
+		return att, nil
+	}
+
+	resultBytes, err := json.Marshal(info.RawResult)
+	if err != nil {
+		return att, err
+	}
+	decoder := version.ConfigDecoder{}
+	resultCniVersion, err := decoder.Decode(resultBytes)
+	if err != nil {
+		return att, err
+	}
+	att.Result, err = version.NewResult(resultCniVersion, resultBytes)
+	if err != nil {
+		return att, err
+	}
+	return att, nil
+}
+
+// CacheGCAction selects what GarbageCollectCache does with stale cache entries
+type CacheGCAction int
+
+const (
+	// CacheGCList only reports stale cache entries
+	CacheGCList CacheGCAction = iota
+	// CacheGCRemove removes stale cache entries without calling any plugins
+	CacheGCRemove
+	// CacheGCDelete executes DEL for each stale cache entry using the cached
+	// network configuration and runtime arguments, and removes the entry if
+	// DEL succeeds
+	CacheGCDelete
+)
+
+// LiveContainers returns a liveness callback for GarbageCollectCache that
+// reports only the given container IDs as alive.
+func LiveContainers(containerIDs ...string) func(containerID string) bool {
+	live := make(map[string]bool, len(containerIDs))
+	for _, id := range containerIDs {
+		live[id] = true
+	}
+	return func(containerID string) bool {
+		return live[containerID]
+	}
+}
+
+// readCachedInfos returns every cniCacheV1 entry in the results cache, and
+// the errors of the entries that could not be read by key. Entries in the
+// legacy format, which do not record the attachment they belong to, count as
+// unreadable.
+func (c *CNIConfig) readCachedInfos() ([]*cachedInfo, map[string]error, error) {
+	store := c.getCacheStore(&RuntimeConf{})
+	keys, err := store.Keys()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	infos := make([]*cachedInfo, 0, len(keys))
+	badEntries := map[string]error{}
+	for _, key := range keys {
+		data, err := store.Get(key)
+		if err != nil {
+			// The entry may have been removed by a concurrent DEL
+			if !os.IsNotExist(err) {
+				badEntries[key] = err
+			}
+			continue
+		}
+		info := &cachedInfo{}
+		if err := json.Unmarshal(data, info); err != nil {
+			badEntries[key] = fmt.Errorf("failed to unmarshal cache entry: %v", err)
+			continue
+		}
+		if info.Kind != CNICacheV1 {
+			badEntries[key] = fmt.Errorf("cache entry has unsupported kind %q", info.Kind)
+			continue
+		}
+		info.key = key
+		infos = append(infos, info)
+	}
+	return infos, badEntries, nil
+}
+
+// confListFromCachedConfig rebuilds a NetworkConfigList from the config
+// bytes stored in a cache entry, which are either a configuration list (from
+// AddNetworkList) or a single network configuration (from AddNetwork).
+func confListFromCachedConfig(config []byte) (*NetworkConfigList, error) {
+	rawConfig := make(map[string]interface{})
+	if err := json.Unmarshal(config, &rawConfig); err != nil {
+		return nil, fmt.Errorf("error parsing cached configuration: %s", err)
+	}
+	if _, ok := rawConfig["plugins"]; ok {
+		return ConfListFromBytes(config)
+	}
+	conf, err := ConfFromBytes(config)
+	if err != nil {
+		return nil, err
+	}
+	return ConfListFromConf(conf)
+}
+
+// GarbageCollectCache finds results cache entries for containers that the
+// isAlive callback no longer reports as alive; typically these are left
+// behind by containers that went away without a DEL. Depending on action the
+// stale entries are only reported, removed, or torn down with DEL using the
+// network configuration and runtime arguments recorded in the cache.
+//
+// All stale entries are returned. If action is CacheGCRemove or
+// CacheGCDelete, processing continues past failures and any errors are
+// returned together.
+func (c *CNIConfig) GarbageCollectCache(ctx context.Context, isAlive func(containerID string) bool, action CacheGCAction) ([]*CachedAttachment, error) {
+	// Entries that cannot be read are left alone
+	infos, _, err := c.readCachedInfos()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results cache: %v", err)
+	}
+
+	stale := []*CachedAttachment{}
+	errs := []error{}
+	for _, info := range infos {
+		if isAlive(info.ContainerID) {
+			continue
+		}
+		// An unparseable result does not prevent collecting the entry
+		att, _ := newCachedAttachment(info)
+		stale = append(stale, att)
+
+		rt := &RuntimeConf{
+			ContainerID:    info.ContainerID,
+			IfName:         info.IfName,
+			Args:           info.CniArgs,
+			CapabilityArgs: info.CapabilityArgs,
+		}
+		switch action {
+		case CacheGCRemove:
+			if err := c.cacheDel(info.NetworkName, rt); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		case CacheGCDelete:
+			list, err := confListFromCachedConfig(info.Config)
+			if err == nil {
+				err = c.DelNetworkList(ctx, list, rt)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete network %q for container %q interface %q: %v", info.NetworkName, info.ContainerID, info.IfName, err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return stale, fmt.Errorf("%v", errs)
+	}
+	return stale, nil
+}
+
 func (c *CNIConfig) addNetwork(ctx context.Context, name, cniVersion string, net *NetworkConfig, prevResult types.Result, rt *RuntimeConf) (types.Result, error) {
-	c.ensureExec()
-	pluginPath, err := c.exec.FindInPath(net.Network.Type, c.Path)
+	pluginPath, err := c.findInPath(net.Network.Type)
 	if err != nil {
 		return nil, err
 	}
@@ -418,30 +862,133 @@ func (c *CNIConfig) addNetwork(ctx context.Context, name, cniVersion string, net
 		return nil, err
 	}
 
-	return invoke.ExecPluginWithResult(ctx, pluginPath, newConf.Bytes, c.args("ADD", rt), c.exec)
+	return c.execPluginWithResult(ctx, name, net, pluginPath, newConf.Bytes, c.args("ADD", rt))
 }
 
 // AddNetworkList executes a sequence of plugins with the ADD command
 func (c *CNIConfig) AddNetworkList(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf) (types.Result, error) {
-	var err error
+	cniVersion := list.CNIVersion
+	list, err := c.negotiatedList(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := c.lockAttachment(ctx, list.Name, rt)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	journal, err := c.journalBegin("ADD", list.Name, list.Bytes, nil, rt)
+	if err != nil {
+		return nil, err
+	}
+	defer journal.finish()
+
 	var result types.Result
+	prevResults := make([]types.Result, 0, len(list.Plugins))
 	for _, net := range list.Plugins {
-		result, err = c.addNetwork(ctx, list.Name, list.CNIVersion, net, result, rt)
+		prevResult := result
+		result, err = c.addNetwork(ctx, list.Name, list.CNIVersion, net, prevResult, rt)
 		if err != nil {
+			if c.RollbackOnFailure && len(prevResults) > 0 {
+				return nil, c.rollbackNetworkList(ctx, list, prevResults, rt, journal, err)
+			}
+			return nil, err
+		}
+		prevResults = append(prevResults, prevResult)
+		if err = journal.addCompleted(result); err != nil {
+			if c.RollbackOnFailure {
+				return nil, c.rollbackNetworkList(ctx, list, prevResults, rt, journal, err)
+			}
 			return nil, err
 		}
 	}
 
+	// Convert the result to the version the caller asked for before the
+	// attachment is recorded. If that fails, the caller has no result to
+	// act on, so the attachment is always rolled back.
+	finalResult := result
+	if cniVersion != "" && cniVersion != list.CNIVersion {
+		if finalResult, err = result.GetAsVersion(cniVersion); err != nil {
+			err = fmt.Errorf("failed to convert network %q result to version %q: %v", list.Name, cniVersion, err)
+			return nil, c.rollbackNetworkList(ctx, list, prevResults, rt, journal, err)
+		}
+	}
+
 	if err = c.cacheAdd(result, list.Bytes, list.Name, rt); err != nil {
-		return nil, fmt.Errorf("failed to set network %q cached result: %v", list.Name, err)
+		err = fmt.Errorf("failed to set network %q cached result: %v", list.Name, err)
+		if c.RollbackOnFailure {
+			return nil, c.rollbackNetworkList(ctx, list, prevResults, rt, journal, err)
+		}
+		return nil, err
 	}
 
-	return result, nil
+	// A journal entry left behind would make RecoverJournal undo the ADD
+	if err = journal.finish(); err != nil {
+		if c.RollbackOnFailure {
+			err = c.rollbackNetworkList(ctx, list, prevResults, rt, journal, err)
+			// The attachment was rolled back, so it must not stay cached
+			_ = c.cacheDel(list.Name, rt)
+			return nil, err
+		}
+		return nil, err
+	}
+
+	return finalResult, nil
+}
+
+// rollbackNetworkList runs DEL in reverse order on the first len(prevResults)
+// plugins of the list, handing each plugin the prevResult it was given on ADD.
+// If any of them fails, the journal entry of the ADD is kept so that
+// RecoverJournal can finish the rollback.
+func (c *CNIConfig) rollbackNetworkList(ctx context.Context, list *NetworkConfigList, prevResults []types.Result, rt *RuntimeConf, journal *journalRecord, addErr error) error {
+	cleanupErrs := c.delPlugins(ctx, list, len(prevResults), rt, addPrevResults(list, prevResults), nil)
+	if len(cleanupErrs) > 0 {
+		journal.keep()
+	}
+	return &RollbackError{Err: addErr, CleanupErrors: cleanupErrs}
+}
+
+// addPrevResults returns a function that gives the prevResult to hand each
+// plugin of the list on DEL when undoing an ADD: the one it was given on ADD,
+// if the version of the list allows one.
+func addPrevResults(list *NetworkConfigList, prevResults []types.Result) func(i int) types.Result {
+	// prevResult on DEL was added in CNI spec version 0.4.0 and higher
+	gtet, err := version.GreaterThanOrEqualTo(list.CNIVersion, "0.4.0")
+	if err != nil {
+		gtet = false
+	}
+	return func(i int) types.Result {
+		if gtet {
+			return prevResults[i]
+		}
+		return nil
+	}
+}
+
+// delPlugins runs DEL in reverse order on the first n plugins of the list,
+// handing plugin i prevResult(i), and returns the failures as
+// *ListPluginError. Every plugin is run even if some fail. If deleted is
+// set, it is called after each plugin that succeeded, with whether every
+// plugin run before it succeeded too.
+func (c *CNIConfig) delPlugins(ctx context.Context, list *NetworkConfigList, n int, rt *RuntimeConf, prevResult func(i int) types.Result, deleted func(noneFailed bool)) []error {
+	var errs []error
+	for i := n - 1; i >= 0; i-- {
+		net := list.Plugins[i]
+		if err := c.delNetwork(ctx, list.Name, list.CNIVersion, net, prevResult(i), rt); err != nil {
+			errs = append(errs, &ListPluginError{Index: i, Type: net.Network.Type, Err: err})
+			continue
+		}
+		if deleted != nil {
+			deleted(len(errs) == 0)
+		}
+	}
+	return errs
 }
 
 func (c *CNIConfig) checkNetwork(ctx context.Context, name, cniVersion string, net *NetworkConfig, prevResult types.Result, rt *RuntimeConf) error {
-	c.ensureExec()
-	pluginPath, err := c.exec.FindInPath(net.Network.Type, c.Path)
+	pluginPath, err := c.findInPath(net.Network.Type)
 	if err != nil {
 		return err
 	}
@@ -451,11 +998,16 @@ func (c *CNIConfig) checkNetwork(ctx context.Context, name, cniVersion string, n
 		return err
 	}
 
-	return invoke.ExecPluginWithoutResult(ctx, pluginPath, newConf.Bytes, c.args("CHECK", rt), c.exec)
+	return c.execPluginWithoutResult(ctx, name, net, pluginPath, newConf.Bytes, c.args("CHECK", rt))
 }
 
 // CheckNetworkList executes a sequence of plugins with the CHECK command
 func (c *CNIConfig) CheckNetworkList(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf) error {
+	list, err := c.negotiatedList(ctx, list)
+	if err != nil {
+		return err
+	}
+
 	// CHECK was added in CNI spec version 0.4.0 and higher
 	if gtet, err := version.GreaterThanOrEqualTo(list.CNIVersion, "0.4.0"); err != nil {
 		return err
@@ -467,6 +1019,12 @@ func (c *CNIConfig) CheckNetworkList(ctx context.Context, list *NetworkConfigLis
 		return nil
 	}
 
+	unlock, err := c.lockAttachment(ctx, list.Name, rt)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	cachedResult, err := c.getCachedResult(list.Name, list.CNIVersion, rt)
 	if err != nil {
 		return fmt.Errorf("failed to get network %q cached result: %v", list.Name, err)
@@ -482,8 +1040,7 @@ func (c *CNIConfig) CheckNetworkList(ctx context.Context, list *NetworkConfigLis
 }
 
 func (c *CNIConfig) delNetwork(ctx context.Context, name, cniVersion string, net *NetworkConfig, prevResult types.Result, rt *RuntimeConf) error {
-	c.ensureExec()
-	pluginPath, err := c.exec.FindInPath(net.Network.Type, c.Path)
+	pluginPath, err := c.findInPath(net.Network.Type)
 	if err != nil {
 		return err
 	}
@@ -493,13 +1050,27 @@ func (c *CNIConfig) delNetwork(ctx context.Context, name, cniVersion string, net
 		return err
 	}
 
-	return invoke.ExecPluginWithoutResult(ctx, pluginPath, newConf.Bytes, c.args("DEL", rt), c.exec)
+	return c.execPluginWithoutResult(ctx, name, net, pluginPath, newConf.Bytes, c.args("DEL", rt))
 }
 
-// DelNetworkList executes a sequence of plugins with the DEL command
+// DelNetworkList executes a sequence of plugins with the DEL command, in
+// reverse order. Every plugin is run even if some fail, in which case the
+// cached result is kept unless RemoveCacheOnDelFailure is set, and the
+// failures are returned as a *DelError.
 func (c *CNIConfig) DelNetworkList(ctx context.Context, list *NetworkConfigList, rt *RuntimeConf) error {
 	var cachedResult types.Result
 
+	list, err := c.negotiatedList(ctx, list)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := c.lockAttachment(ctx, list.Name, rt)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Cached result on DEL was added in CNI spec version 0.4.0 and higher
 	if gtet, err := version.GreaterThanOrEqualTo(list.CNIVersion, "0.4.0"); err != nil {
 		return err
@@ -510,19 +1081,92 @@ func (c *CNIConfig) DelNetworkList(ctx context.Context, list *NetworkConfigList,
 		}
 	}
 
-	for i := len(list.Plugins) - 1; i >= 0; i-- {
-		net := list.Plugins[i]
-		if err := c.delNetwork(ctx, list.Name, list.CNIVersion, net, cachedResult, rt); err != nil {
-			return err
+	journal, err := c.journalBegin("DEL", list.Name, list.Bytes, cachedResult, rt)
+	if err != nil {
+		return err
+	}
+	defer journal.finish()
+
+	var journalErr error
+	errs := c.delPlugins(ctx, list, len(list.Plugins), rt, func(int) types.Result {
+		return cachedResult
+	}, func(noneFailed bool) {
+		// Progress is only recorded up to the first failure, so that
+		// RecoverJournal runs DEL again on the plugin that failed
+		if noneFailed && journalErr == nil {
+			journalErr = journal.delCompleted()
 		}
+	})
+	if journalErr != nil {
+		errs = append(errs, journalErr)
 	}
-	_ = c.cacheDel(list.Name, rt)
 
+	if len(errs) == 0 || c.RemoveCacheOnDelFailure {
+		_ = c.cacheDel(list.Name, rt)
+	}
+	if len(errs) > 0 {
+		return &DelError{Errors: errs}
+	}
 	return nil
 }
 
+// cachedNetworkList rebuilds the configuration list and RuntimeConf that
+// were used to add the attachment of the container and interface of rt to
+// network netName, from its results cache entry
+func (c *CNIConfig) cachedNetworkList(netName string, rt *RuntimeConf) (*NetworkConfigList, *RuntimeConf, error) {
+	config, newRt, err := c.getCachedConfig(netName, rt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config == nil {
+		return nil, nil, fmt.Errorf("no cached configuration for network %q container %q interface %q", netName, rt.ContainerID, rt.IfName)
+	}
+	list, err := confListFromCachedConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse cached network %q config: %v", netName, err)
+	}
+	return list, newRt, nil
+}
+
+// CheckNetworkListFromCache executes CheckNetworkList with the configuration
+// list, CNI args and capability args recorded in the results cache when the
+// container and interface of rt were added to network netName, instead of
+// the current configuration of the network.
+func (c *CNIConfig) CheckNetworkListFromCache(ctx context.Context, netName string, rt *RuntimeConf) error {
+	list, newRt, err := c.cachedNetworkList(netName, rt)
+	if err != nil {
+		return err
+	}
+	return c.CheckNetworkList(ctx, list, newRt)
+}
+
+// DelNetworkListFromCache executes DelNetworkList with the configuration
+// list, CNI args and capability args recorded in the results cache when the
+// container and interface of rt were added to network netName, so that the
+// attachment can be torn down even after the network's configuration was
+// changed or removed.
+func (c *CNIConfig) DelNetworkListFromCache(ctx context.Context, netName string, rt *RuntimeConf) error {
+	list, newRt, err := c.cachedNetworkList(netName, rt)
+	if err != nil {
+		return err
+	}
+	return c.DelNetworkList(ctx, list, newRt)
+}
+
 // AddNetwork executes the plugin with the ADD command
 func (c *CNIConfig) AddNetwork(ctx context.Context, net *NetworkConfig, rt *RuntimeConf) (types.Result, error) {
+	unlock, err := c.lockAttachment(ctx, net.Network.Name, rt)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	journal, err := c.journalBegin("ADD", net.Network.Name, net.Bytes, nil, rt)
+	if err != nil {
+		return nil, err
+	}
+	defer journal.finish()
+
 	result, err := c.addNetwork(ctx, net.Network.Name, net.Network.CNIVersion, net, nil, rt)
 	if err != nil {
 		return nil, err
@@ -532,6 +1176,11 @@ func (c *CNIConfig) AddNetwork(ctx context.Context, net *NetworkConfig, rt *Runt
 		return nil, fmt.Errorf("failed to set network %q cached result: %v", net.Network.Name, err)
 	}
 
+	// A journal entry left behind would make RecoverJournal undo the ADD
+	if err = journal.finish(); err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
 
@@ -544,6 +1193,12 @@ func (c *CNIConfig) CheckNetwork(ctx context.Context, net *NetworkConfig, rt *Ru
 		return fmt.Errorf("configuration version %q does not support the CHECK command", net.Network.CNIVersion)
 	}
 
+	unlock, err := c.lockAttachment(ctx, net.Network.Name, rt)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	cachedResult, err := c.getCachedResult(net.Network.Name, net.Network.CNIVersion, rt)
 	if err != nil {
 		return fmt.Errorf("failed to get network %q cached result: %v", net.Network.Name, err)
@@ -555,6 +1210,12 @@ func (c *CNIConfig) CheckNetwork(ctx context.Context, net *NetworkConfig, rt *Ru
 func (c *CNIConfig) DelNetwork(ctx context.Context, net *NetworkConfig, rt *RuntimeConf) error {
 	var cachedResult types.Result
 
+	unlock, err := c.lockAttachment(ctx, net.Network.Name, rt)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Cached result on DEL was added in CNI spec version 0.4.0 and higher
 	if gtet, err := version.GreaterThanOrEqualTo(net.Network.CNIVersion, "0.4.0"); err != nil {
 		return err
@@ -565,6 +1226,12 @@ func (c *CNIConfig) DelNetwork(ctx context.Context, net *NetworkConfig, rt *Runt
 		}
 	}
 
+	journal, err := c.journalBegin("DEL", net.Network.Name, net.Bytes, cachedResult, rt)
+	if err != nil {
+		return err
+	}
+	defer journal.finish()
+
 	if err := c.delNetwork(ctx, net.Network.Name, net.Network.CNIVersion, net, cachedResult, rt); err != nil {
 		return err
 	}
@@ -572,12 +1239,172 @@ func (c *CNIConfig) DelNetwork(ctx context.Context, net *NetworkConfig, rt *Runt
 	return nil
 }
 
+// pluginSupportsCommand reports whether a plugin may be sent a command that
+// was added in CNI spec version minVersion. Both the configuration version
+// and one of the versions the plugin reports supporting must be minVersion
+// or later, since older plugins do not recognize the command.
+func (c *CNIConfig) pluginSupportsCommand(ctx context.Context, cniVersion, minVersion string, net *NetworkConfig, pluginPath string) (bool, error) {
+	if gtet, err := version.GreaterThanOrEqualTo(cniVersion, minVersion); err != nil || !gtet {
+		return false, err
+	}
+
+	vi, err := c.getVersionInfo(ctx, net.Network.Type, pluginPath)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range vi.SupportedVersions() {
+		if gtet, err := version.GreaterThanOrEqualTo(v, minVersion); err == nil && gtet {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *CNIConfig) gcNetwork(ctx context.Context, name, cniVersion string, net *NetworkConfig, validAttachments []types.GCAttachment) error {
+	pluginPath, err := c.findInPath(net.Network.Type)
+	if err != nil {
+		return err
+	}
+
+	// GC was added in CNI spec version 1.1.0 and higher. Plugins that
+	// predate it have nothing to collect.
+	if supported, err := c.pluginSupportsCommand(ctx, cniVersion, "1.1.0", net, pluginPath); err != nil || !supported {
+		return err
+	}
+
+	newConf, err := buildOneConfig(name, cniVersion, net, nil, &RuntimeConf{})
+	if err != nil {
+		return err
+	}
+	newConf, err = InjectConf(newConf, map[string]interface{}{"cni.dev/valid-attachments": validAttachments})
+	if err != nil {
+		return err
+	}
+
+	return c.execPluginWithoutResult(ctx, name, net, pluginPath, newConf.Bytes, c.args("GC", &RuntimeConf{}))
+}
+
+// GCNetworkList executes a sequence of plugins with the GC command, so that
+// they release any resources held for attachments to the network that are
+// no longer valid. The valid attachments are those in the results cache, so
+// stale cache entries should be removed first, for example with
+// GarbageCollectCache. If any cache entry of the network cannot be read,
+// no plugin is run and a *CacheReadError is returned, since the attachment
+// it records would be collected. Plugins that predate GC, and lists whose
+// version predates it, are skipped. All plugins are run even if some fail,
+// and any errors are returned together.
+func (c *CNIConfig) GCNetworkList(ctx context.Context, list *NetworkConfigList) error {
+	list, err := c.negotiatedList(ctx, list)
+	if err != nil {
+		return err
+	}
+
+	// Fail closed: an attachment missing from the list would be collected
+	attachments, err := c.ListCachedAttachments(list.Name, "")
+	if err != nil {
+		return err
+	}
+	validAttachments := make([]types.GCAttachment, 0, len(attachments))
+	for _, att := range attachments {
+		validAttachments = append(validAttachments, types.GCAttachment{
+			ContainerID: att.ContainerID,
+			IfName:      att.IfName,
+		})
+	}
+
+	errs := []error{}
+	for i, net := range list.Plugins {
+		if err := c.gcNetwork(ctx, list.Name, list.CNIVersion, net, validAttachments); err != nil {
+			errs = append(errs, fmt.Errorf("plugin %d (type %q): %v", i, net.Network.Type, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// PluginStatus is the readiness of one plugin of a network configuration
+// list, as reported by its STATUS command
+type PluginStatus struct {
+	// Index is the position of the plugin in the list
+	Index int
+	Type  string
+	Ready bool
+	// Err is why the plugin is not ready, usually a *types.Error with
+	// code types.ErrPluginNotAvailable or types.ErrLimitedConnectivity
+	Err error
+}
+
+func (c *CNIConfig) getStatus(ctx context.Context, name, cniVersion string, net *NetworkConfig) error {
+	pluginPath, err := c.findInPath(net.Network.Type)
+	if err != nil {
+		return err
+	}
+
+	// STATUS was added in CNI spec version 1.1.0 and higher. Plugins that
+	// predate it are assumed to be ready.
+	if supported, err := c.pluginSupportsCommand(ctx, cniVersion, "1.1.0", net, pluginPath); err != nil || !supported {
+		return err
+	}
+
+	newConf, err := buildOneConfig(name, cniVersion, net, nil, &RuntimeConf{})
+	if err != nil {
+		return err
+	}
+
+	inv := &PluginInvocation{
+		Command:     "STATUS",
+		NetworkName: name,
+		PluginType:  net.Network.Type,
+		PluginPath:  pluginPath,
+	}
+	_, err = c.execPlugin(ctx, inv, net.ExecTimeout, func(ctx context.Context, exec invoke.Exec) (types.Result, error) {
+		return nil, invoke.GetStatus(ctx, pluginPath, newConf.Bytes, c.Path, exec)
+	})
+	return err
+}
+
+// GetStatusNetworkList executes every plugin of the list with the STATUS
+// command, to find out whether the network is ready to service ADD
+// requests. It returns the status of each plugin, and an error listing the
+// plugins that are not ready, if any. Plugins that predate STATUS, and all
+// plugins of lists whose version predates it, are reported ready.
+func (c *CNIConfig) GetStatusNetworkList(ctx context.Context, list *NetworkConfigList) ([]*PluginStatus, error) {
+	list, err := c.negotiatedList(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*PluginStatus, 0, len(list.Plugins))
+	errs := []error{}
+	for i, net := range list.Plugins {
+		status := &PluginStatus{Index: i, Type: net.Network.Type, Ready: true}
+		if err := c.getStatus(ctx, list.Name, list.CNIVersion, net); err != nil {
+			status.Ready = false
+			status.Err = err
+			errs = append(errs, fmt.Errorf("plugin %d (type %q): %v", i, net.Network.Type, err))
+		}
+		statuses = append(statuses, status)
+	}
+
+	if len(errs) > 0 {
+		return statuses, fmt.Errorf("%v", errs)
+	}
+	return statuses, nil
+}
+
 // ValidateNetworkList checks that a configuration is reasonably valid.
 // - all the specified plugins exist on disk
 // - every plugin supports the desired version.
 //
 // Returns a list of all capabilities supported by the configuration, or error
 func (c *CNIConfig) ValidateNetworkList(ctx context.Context, list *NetworkConfigList) ([]string, error) {
+	list, err := c.negotiatedList(ctx, list)
+	if err != nil {
+		return nil, err
+	}
 	version := list.CNIVersion
 
 	// holding map for seen caps (in case of duplicates)
@@ -627,8 +1454,7 @@ func (c *CNIConfig) ValidateNetwork(ctx context.Context, net *NetworkConfig) ([]
 
 // validatePlugin checks that an individual plugin's configuration is sane
 func (c *CNIConfig) validatePlugin(ctx context.Context, pluginName, expectedVersion string) error {
-	c.ensureExec()
-	pluginPath, err := c.exec.FindInPath(pluginName, c.Path)
+	pluginPath, err := c.findInPath(pluginName)
 	if err != nil {
 		return err
 	}
@@ -636,7 +1462,7 @@ func (c *CNIConfig) validatePlugin(ctx context.Context, pluginName, expectedVers
 		expectedVersion = "0.1.0"
 	}
 
-	vi, err := invoke.GetVersionInfo(ctx, pluginPath, c.exec)
+	vi, err := c.getVersionInfo(ctx, pluginName, pluginPath)
 	if err != nil {
 		return err
 	}
@@ -651,16 +1477,123 @@ func (c *CNIConfig) validatePlugin(ctx context.Context, pluginName, expectedVers
 // GetVersionInfo reports which versions of the CNI spec are supported by
 // the given plugin.
 func (c *CNIConfig) GetVersionInfo(ctx context.Context, pluginType string) (version.PluginInfo, error) {
-	c.ensureExec()
-	pluginPath, err := c.exec.FindInPath(pluginType, c.Path)
+	pluginPath, err := c.findInPath(pluginType)
 	if err != nil {
 		return nil, err
 	}
 
-	return invoke.GetVersionInfo(ctx, pluginPath, c.exec)
+	return c.getVersionInfo(ctx, pluginType, pluginPath)
 }
 
 // =====
+// execPluginWithResult runs a plugin command that returns a result
+func (c *CNIConfig) execPluginWithResult(ctx context.Context, name string, net *NetworkConfig, pluginPath string, netconf []byte, args *invoke.Args) (types.Result, error) {
+	inv := &PluginInvocation{
+		Command:     args.Command,
+		NetworkName: name,
+		PluginType:  net.Network.Type,
+		PluginPath:  pluginPath,
+	}
+	return c.execPlugin(ctx, inv, net.ExecTimeout, func(ctx context.Context, exec invoke.Exec) (types.Result, error) {
+		return invoke.ExecPluginWithResult(ctx, pluginPath, netconf, args, exec)
+	})
+}
+
+// execPluginWithoutResult runs a plugin command that does not return a result
+func (c *CNIConfig) execPluginWithoutResult(ctx context.Context, name string, net *NetworkConfig, pluginPath string, netconf []byte, args *invoke.Args) error {
+	inv := &PluginInvocation{
+		Command:     args.Command,
+		NetworkName: name,
+		PluginType:  net.Network.Type,
+		PluginPath:  pluginPath,
+	}
+	_, err := c.execPlugin(ctx, inv, net.ExecTimeout, func(ctx context.Context, exec invoke.Exec) (types.Result, error) {
+		return nil, invoke.ExecPluginWithoutResult(ctx, pluginPath, netconf, args, exec)
+	})
+	return err
+}
+
+// getVersionInfo runs the VERSION command of a plugin, unless its result
+// is in the plugin cache
+func (c *CNIConfig) getVersionInfo(ctx context.Context, pluginType, pluginPath string) (version.PluginInfo, error) {
+	inv := &PluginInvocation{
+		Command:    "VERSION",
+		PluginType: pluginType,
+		PluginPath: pluginPath,
+	}
+	return c.PluginCache.getVersionInfo(pluginPath, func() (version.PluginInfo, error) {
+		var vi version.PluginInfo
+		_, err := c.execPlugin(ctx, inv, 0, func(ctx context.Context, exec invoke.Exec) (types.Result, error) {
+			var err error
+			vi, err = invoke.GetVersionInfo(ctx, pluginPath, exec)
+			return nil, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return vi, nil
+	})
+}
+
+// execPlugin runs fn, which invokes a plugin through the given Exec. All
+// plugin invocations by libcni go through here, so that the retry policy,
+// the timeout of the plugin and the observer apply to each of them.
+func (c *CNIConfig) execPlugin(ctx context.Context, inv *PluginInvocation, timeout time.Duration, fn func(context.Context, invoke.Exec) (types.Result, error)) (types.Result, error) {
+	var result types.Result
+	err := c.Retry.withRetry(ctx, func() error {
+		var err error
+		result, err = c.observe(ctx, inv, func(exec invoke.Exec) (types.Result, error) {
+			var result types.Result
+			err := withExecTimeout(ctx, inv, timeout, func(ctx context.Context) error {
+				var err error
+				result, err = fn(ctx, exec)
+				return err
+			})
+			return result, err
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TimeoutError is returned when a plugin runs for longer than the
+// ExecTimeout of its network configuration
+type TimeoutError struct {
+	Plugin  string
+	Command string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("plugin %q timed out after %v running %s", e.Plugin, e.Timeout, e.Command)
+}
+
+// Unwrap returns context.DeadlineExceeded, so that TimeoutErrors can be told
+// apart from other failures the same way as an expired context
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// withExecTimeout calls fn with a context that expires after timeout, if
+// it is non-zero
+func withExecTimeout(ctx context.Context, inv *PluginInvocation, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := fn(execCtx)
+	// Only report a timeout if our deadline, rather than the caller's, expired
+	if err != nil && execCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return &TimeoutError{Plugin: inv.PluginType, Command: inv.Command, Timeout: timeout}
+	}
+	return err
+}
+
 func (c *CNIConfig) args(action string, rt *RuntimeConf) *invoke.Args {
 	return &invoke.Args{
 		Command:     action,
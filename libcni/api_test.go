@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -28,9 +29,11 @@ import (
 	"time"
 
 	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/types/current"
+	"github.com/containernetworking/cni/pkg/version"
 	noop_debug "github.com/containernetworking/cni/plugins/test/noop/debug"
 
 	. "github.com/onsi/ginkgo"
@@ -806,7 +809,7 @@ var _ = Describe("Invoking plugins", func() {
 
 				Expect(versionInfo).NotTo(BeNil())
 				Expect(versionInfo.SupportedVersions()).To(Equal([]string{
-					"0.-42.0", "0.1.0", "0.2.0", "0.3.0", "0.3.1", "0.4.0",
+					"0.-42.0", "0.1.0", "0.2.0", "0.3.0", "0.3.1", "0.4.0", "1.0.0", "1.1.0",
 				}))
 			})
 
@@ -856,6 +859,16 @@ var _ = Describe("Invoking plugins", func() {
 			expectedCmdArgs skel.CmdArgs
 		)
 
+		setListVersion := func(cniVersion string) {
+			confList := make(map[string]interface{})
+			Expect(json.Unmarshal(netConfigList.Bytes, &confList)).To(Succeed())
+			confList["cniVersion"] = cniVersion
+			newBytes, err := json.Marshal(confList)
+			Expect(err).NotTo(HaveOccurred())
+			netConfigList, err = libcni.ConfListFromBytes(newBytes)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
 		BeforeEach(func() {
 			var err error
 
@@ -1135,6 +1148,37 @@ var _ = Describe("Invoking plugins", func() {
 				})
 			})
 
+			Context("when rollback on failure is enabled", func() {
+				BeforeEach(func() {
+					cniConfig.RollbackOnFailure = true
+					plugins[2].debug.ReportError = "plugin error: banana"
+					Expect(plugins[2].debug.WriteDebug(plugins[2].debugFilePath)).To(Succeed())
+				})
+
+				It("executes DEL on the plugins that succeeded with the prevResult each one saw", func() {
+					result, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+					Expect(result).To(BeNil())
+					Expect(err).To(MatchError("plugin error: banana"))
+					rbErr, ok := err.(*libcni.RollbackError)
+					Expect(ok).To(BeTrue())
+					Expect(rbErr.CleanupErrors).To(BeEmpty())
+
+					debug, err := noop_debug.ReadDebug(plugins[0].debugFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(debug.Command).To(Equal("DEL"))
+					Expect(string(debug.CmdArgs.StdinData)).NotTo(ContainSubstring("\"prevResult\":"))
+
+					debug, err = noop_debug.ReadDebug(plugins[1].debugFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(debug.Command).To(Equal("DEL"))
+					var data map[string]interface{}
+					Expect(json.Unmarshal(debug.CmdArgs.StdinData, &data)).To(Succeed())
+					stdinPrevResult, err := json.Marshal(data["prevResult"])
+					Expect(err).NotTo(HaveOccurred())
+					Expect(stdinPrevResult).To(MatchJSON(ipResult))
+				})
+			})
+
 			Context("when the cache directory cannot be accessed", func() {
 				It("returns an error when the results cache file cannot be written", func() {
 					// Make the results directory inaccessible by making it a
@@ -1389,10 +1433,61 @@ var _ = Describe("Invoking plugins", func() {
 				BeforeEach(func() {
 					plugins[1].debug.ReportError = "plugin error: banana"
 					Expect(plugins[1].debug.WriteDebug(plugins[1].debugFilePath)).To(Succeed())
+
+					cacheFile := resultCacheFilePath(cacheDirPath, netConfigList.Name, runtimeConfig)
+					Expect(os.MkdirAll(filepath.Dir(cacheFile), 0700)).To(Succeed())
+					Expect(ioutil.WriteFile(cacheFile, []byte(ipResult), 0600)).To(Succeed())
 				})
-				It("unmarshals and returns the error", func() {
+
+				It("runs the other plugins and returns the error", func() {
 					err := cniConfig.DelNetworkList(ctx, netConfigList, runtimeConfig)
-					Expect(err).To(MatchError("plugin error: banana"))
+					Expect(err).To(MatchError(`[plugin 1 (type "noop"): plugin error: banana]`))
+					delErr, ok := err.(*libcni.DelError)
+					Expect(ok).To(BeTrue())
+					Expect(delErr.Errors).To(HaveLen(1))
+					perr := delErr.Unwrap().(*libcni.ListPluginError)
+					Expect(perr.Index).To(Equal(1))
+					Expect(perr.Type).To(Equal("noop"))
+					Expect(perr.Unwrap()).To(BeAssignableToTypeOf(&types.Error{}))
+					Expect(delErr.Code()).To(Equal(perr.Err.(*types.Error).Code))
+
+					for _, i := range []int{0, 2} {
+						debug, err := noop_debug.ReadDebug(plugins[i].debugFilePath)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(debug.Command).To(Equal("DEL"))
+					}
+
+					// The cached result is kept so that DEL can be retried
+					cachedResult, err := cniConfig.GetNetworkListCachedResult(netConfigList, runtimeConfig)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(cachedResult).NotTo(BeNil())
+				})
+
+				It("returns the errors of all the plugins that failed", func() {
+					plugins[2].debug.ReportError = "plugin error: cherry"
+					Expect(plugins[2].debug.WriteDebug(plugins[2].debugFilePath)).To(Succeed())
+
+					err := cniConfig.DelNetworkList(ctx, netConfigList, runtimeConfig)
+					Expect(err).To(MatchError(`[plugin 2 (type "noop"): plugin error: cherry plugin 1 (type "noop"): plugin error: banana]`))
+					delErr, ok := err.(*libcni.DelError)
+					Expect(ok).To(BeTrue())
+					Expect(delErr.Errors).To(HaveLen(2))
+					Expect(delErr.Errors[1].(*libcni.ListPluginError).Index).To(Equal(1))
+					Expect(delErr.Errors[1].(*libcni.ListPluginError).Err).To(MatchError("plugin error: banana"))
+
+					debug, err := noop_debug.ReadDebug(plugins[0].debugFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(debug.Command).To(Equal("DEL"))
+				})
+
+				It("removes the cached result if RemoveCacheOnDelFailure is set", func() {
+					cniConfig.RemoveCacheOnDelFailure = true
+					err := cniConfig.DelNetworkList(ctx, netConfigList, runtimeConfig)
+					Expect(err).To(HaveOccurred())
+
+					cachedResult, err := cniConfig.GetNetworkListCachedResult(netConfigList, runtimeConfig)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(cachedResult).To(BeNil())
 				})
 			})
 
@@ -1409,6 +1504,248 @@ var _ = Describe("Invoking plugins", func() {
 				})
 			})
 		})
+		Describe("DelNetworkListFromCache", func() {
+			It("executes the cached plugins with the cached arguments", func() {
+				_, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				rt := &libcni.RuntimeConf{
+					ContainerID: runtimeConfig.ContainerID,
+					NetNS:       runtimeConfig.NetNS,
+					IfName:      runtimeConfig.IfName,
+				}
+				err = cniConfig.DelNetworkListFromCache(ctx, netConfigList.Name, rt)
+				Expect(err).NotTo(HaveOccurred())
+
+				for i := 0; i < len(plugins); i++ {
+					debug, err := noop_debug.ReadDebug(plugins[i].debugFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(debug.Command).To(Equal("DEL"))
+					Expect(debug.CmdArgs.Args).To(Equal("FOO=BAR"))
+				}
+				debug, err := noop_debug.ReadDebug(plugins[0].debugFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(debug.CmdArgs.StdinData)).To(ContainSubstring(`"portMappings":`))
+
+				cachedConfig, _, err := cniConfig.GetNetworkListCachedConfig(netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cachedConfig).To(BeNil())
+			})
+
+			It("returns an error when nothing is cached", func() {
+				err := cniConfig.DelNetworkListFromCache(ctx, netConfigList.Name, runtimeConfig)
+				Expect(err).To(MatchError(`no cached configuration for network "some-list" container "some-container-id" interface "some-eth0"`))
+			})
+		})
+
+		Describe("CheckNetworkListFromCache", func() {
+			It("executes the cached plugins with the cached arguments", func() {
+				_, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				rt := &libcni.RuntimeConf{
+					ContainerID: runtimeConfig.ContainerID,
+					NetNS:       runtimeConfig.NetNS,
+					IfName:      runtimeConfig.IfName,
+				}
+				err = cniConfig.CheckNetworkListFromCache(ctx, netConfigList.Name, rt)
+				Expect(err).NotTo(HaveOccurred())
+
+				for i := 0; i < len(plugins); i++ {
+					debug, err := noop_debug.ReadDebug(plugins[i].debugFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(debug.Command).To(Equal("CHECK"))
+					Expect(debug.CmdArgs.Args).To(Equal("FOO=BAR"))
+				}
+			})
+		})
+
+		Describe("GCNetworkList", func() {
+			BeforeEach(func() {
+				// GC was added in CNI spec version 1.1.0
+				setListVersion("1.1.0")
+			})
+
+			It("executes all the plugins with command GC and the cached attachments", func() {
+				_, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				err = cniConfig.GCNetworkList(ctx, netConfigList)
+				Expect(err).NotTo(HaveOccurred())
+
+				for i := 0; i < len(plugins); i++ {
+					debug, err := noop_debug.ReadDebug(plugins[i].debugFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(debug.Command).To(Equal("GC"))
+					Expect(debug.CmdArgs.ContainerID).To(BeEmpty())
+					Expect(debug.CmdArgs.IfName).To(BeEmpty())
+					Expect(debug.CmdArgs.Path).To(Equal(cniBinPath))
+
+					conf := &types.NetConf{}
+					Expect(json.Unmarshal(debug.CmdArgs.StdinData, conf)).To(Succeed())
+					Expect(conf.Name).To(Equal("some-list"))
+					Expect(conf.ValidAttachments).To(Equal([]types.GCAttachment{
+						{ContainerID: runtimeConfig.ContainerID, IfName: runtimeConfig.IfName},
+					}))
+				}
+			})
+
+			It("sends an empty list when there are no attachments", func() {
+				err := cniConfig.GCNetworkList(ctx, netConfigList)
+				Expect(err).NotTo(HaveOccurred())
+
+				debug, err := noop_debug.ReadDebug(plugins[0].debugFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(debug.Command).To(Equal("GC"))
+				stdin := map[string]interface{}{}
+				Expect(json.Unmarshal(debug.CmdArgs.StdinData, &stdin)).To(Succeed())
+				Expect(stdin["cni.dev/valid-attachments"]).To(Equal([]interface{}{}))
+			})
+
+			It("runs no plugin when a cache entry of the network cannot be read", func() {
+				_, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+				otherRt := &libcni.RuntimeConf{ContainerID: "other-container-id", IfName: "eth0"}
+				Expect(ioutil.WriteFile(resultCacheFilePath(cacheDirPath, "some-list", otherRt), []byte("{"), 0600)).To(Succeed())
+
+				err = cniConfig.GCNetworkList(ctx, netConfigList)
+				Expect(err).To(BeAssignableToTypeOf(&libcni.CacheReadError{}))
+				Expect(err.(*libcni.CacheReadError).Errors).To(HaveKey("some-list-other-container-id-eth0"))
+
+				for i := 0; i < len(plugins); i++ {
+					debug, err := noop_debug.ReadDebug(plugins[i].debugFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(debug.Command).To(Equal("ADD"))
+				}
+			})
+
+			It("skips lists whose version predates GC", func() {
+				setListVersion("1.0.0")
+				Expect(cniConfig.GCNetworkList(ctx, netConfigList)).To(Succeed())
+
+				for i := 0; i < len(plugins); i++ {
+					debug, err := noop_debug.ReadDebug(plugins[i].debugFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(debug.Command).To(BeEmpty())
+				}
+			})
+
+			It("skips plugins that predate GC", func() {
+				gcCalled := false
+				exec := invoke.NewInProcessExec(nil)
+				exec.Register("noop", invoke.PluginFuncs{
+					GC: func(*skel.CmdArgs) error {
+						gcCalled = true
+						return nil
+					},
+					VersionInfo: version.PluginSupports("0.4.0", "1.0.0"),
+				})
+				cniConfig = libcni.NewCNIConfigWithCacheDir([]string{cniBinPath}, cacheDirPath, exec)
+
+				Expect(cniConfig.GCNetworkList(ctx, netConfigList)).To(Succeed())
+				Expect(gcCalled).To(BeFalse())
+			})
+
+			Context("when a plugin errors", func() {
+				BeforeEach(func() {
+					plugins[1].debug.ReportError = "plugin error: banana"
+					Expect(plugins[1].debug.WriteDebug(plugins[1].debugFilePath)).To(Succeed())
+				})
+
+				It("runs the other plugins and returns the error", func() {
+					err := cniConfig.GCNetworkList(ctx, netConfigList)
+					Expect(err).To(MatchError(`[plugin 1 (type "noop"): plugin error: banana]`))
+
+					debug, err := noop_debug.ReadDebug(plugins[2].debugFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(debug.Command).To(Equal("GC"))
+				})
+			})
+		})
+
+		Describe("GetStatusNetworkList", func() {
+			BeforeEach(func() {
+				// STATUS was added in CNI spec version 1.1.0
+				setListVersion("1.1.0")
+			})
+
+			It("executes all the plugins with command STATUS and reports them ready", func() {
+				statuses, err := cniConfig.GetStatusNetworkList(ctx, netConfigList)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(statuses).To(HaveLen(3))
+
+				for i := 0; i < len(plugins); i++ {
+					Expect(statuses[i]).To(Equal(&libcni.PluginStatus{Index: i, Type: "noop", Ready: true}))
+
+					debug, err := noop_debug.ReadDebug(plugins[i].debugFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(debug.Command).To(Equal("STATUS"))
+					Expect(debug.CmdArgs.ContainerID).To(BeEmpty())
+					Expect(debug.CmdArgs.Netns).To(BeEmpty())
+					Expect(debug.CmdArgs.IfName).To(BeEmpty())
+					Expect(debug.CmdArgs.Path).To(Equal(cniBinPath))
+				}
+			})
+
+			It("reports the plugins of lists whose version predates STATUS ready", func() {
+				setListVersion("1.0.0")
+				statuses, err := cniConfig.GetStatusNetworkList(ctx, netConfigList)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(statuses).To(HaveLen(3))
+
+				for i := 0; i < len(plugins); i++ {
+					Expect(statuses[i].Ready).To(BeTrue())
+					debug, err := noop_debug.ReadDebug(plugins[i].debugFilePath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(debug.Command).To(BeEmpty())
+				}
+			})
+
+			It("reports plugins that predate STATUS ready", func() {
+				exec := invoke.NewInProcessExec(nil)
+				exec.Register("noop", invoke.PluginFuncs{
+					Status: func(*skel.CmdArgs) error {
+						return errors.New("should not be called")
+					},
+					VersionInfo: version.PluginSupports("0.4.0", "1.0.0"),
+				})
+				cniConfig = libcni.NewCNIConfigWithCacheDir([]string{cniBinPath}, cacheDirPath, exec)
+
+				statuses, err := cniConfig.GetStatusNetworkList(ctx, netConfigList)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(statuses).To(HaveLen(3))
+			})
+
+			Context("when a plugin is not ready", func() {
+				BeforeEach(func() {
+					plugins[1].debug.ReportError = "overlay daemon is not running"
+					Expect(plugins[1].debug.WriteDebug(plugins[1].debugFilePath)).To(Succeed())
+				})
+
+				It("reports the plugin as not ready and returns the error", func() {
+					statuses, err := cniConfig.GetStatusNetworkList(ctx, netConfigList)
+					Expect(err).To(MatchError(`[plugin 1 (type "noop"): overlay daemon is not running]`))
+					Expect(statuses).To(HaveLen(3))
+					Expect(statuses[0].Ready).To(BeTrue())
+					Expect(statuses[1].Ready).To(BeFalse())
+					Expect(statuses[1].Err).To(MatchError("overlay daemon is not running"))
+					Expect(statuses[2].Ready).To(BeTrue())
+				})
+			})
+
+			Context("when finding the plugin fails", func() {
+				BeforeEach(func() {
+					netConfigList.Plugins[1].Network.Type = "does-not-exist"
+				})
+
+				It("reports the plugin as not ready", func() {
+					statuses, err := cniConfig.GetStatusNetworkList(ctx, netConfigList)
+					Expect(err).To(MatchError(ContainSubstring(`failed to find plugin "does-not-exist"`)))
+					Expect(statuses[1].Ready).To(BeFalse())
+				})
+			})
+		})
+
 		Describe("ValidateNetworkList", func() {
 			It("Checks that all plugins exist", func() {
 				caps, err := cniConfig.ValidateNetworkList(ctx, netConfigList)
@@ -1508,7 +1845,7 @@ var _ = Describe("Invoking plugins", func() {
 					result, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
 					cancel()
 					Expect(result).To(BeNil())
-					Expect(err).To(MatchError(ContainSubstring("netplugin failed with no error message")))
+					Expect(err).To(MatchError(ContainSubstring("was killed: context deadline exceeded")))
 				})
 
 			})
@@ -1520,7 +1857,7 @@ var _ = Describe("Invoking plugins", func() {
 					ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
 					err := cniConfig.DelNetwork(ctx, netConfig, runtimeConfig)
 					cancel()
-					Expect(err).To(MatchError(ContainSubstring("netplugin failed with no error message")))
+					Expect(err).To(MatchError(ContainSubstring("was killed: context deadline exceeded")))
 				})
 
 			})
@@ -1532,7 +1869,7 @@ var _ = Describe("Invoking plugins", func() {
 					ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
 					err := cniConfig.CheckNetwork(ctx, netConfig, runtimeConfig)
 					cancel()
-					Expect(err).To(MatchError(ContainSubstring("netplugin failed with no error message")))
+					Expect(err).To(MatchError(ContainSubstring("was killed: context deadline exceeded")))
 				})
 
 			})
@@ -1545,7 +1882,7 @@ var _ = Describe("Invoking plugins", func() {
 					result, err := cniConfig.GetVersionInfo(ctx, "sleep")
 					cancel()
 					Expect(result).To(BeNil())
-					Expect(err).To(MatchError(ContainSubstring("netplugin failed with no error message")))
+					Expect(err).To(MatchError(ContainSubstring("was killed: context deadline exceeded")))
 				})
 
 			})
@@ -1557,7 +1894,7 @@ var _ = Describe("Invoking plugins", func() {
 					ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
 					_, err := cniConfig.ValidateNetwork(ctx, netConfig)
 					cancel()
-					Expect(err).To(MatchError(ContainSubstring("netplugin failed with no error message")))
+					Expect(err).To(MatchError(ContainSubstring("was killed: context deadline exceeded")))
 				})
 
 			})
@@ -1570,7 +1907,7 @@ var _ = Describe("Invoking plugins", func() {
 					result, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
 					cancel()
 					Expect(result).To(BeNil())
-					Expect(err).To(MatchError(ContainSubstring("netplugin failed with no error message")))
+					Expect(err).To(MatchError(ContainSubstring("was killed: context deadline exceeded")))
 				})
 
 			})
@@ -1582,7 +1919,7 @@ var _ = Describe("Invoking plugins", func() {
 					ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
 					err := cniConfig.DelNetworkList(ctx, netConfigList, runtimeConfig)
 					cancel()
-					Expect(err).To(MatchError(ContainSubstring("netplugin failed with no error message")))
+					Expect(err).To(MatchError(ContainSubstring("was killed: context deadline exceeded")))
 				})
 
 			})
@@ -1594,7 +1931,7 @@ var _ = Describe("Invoking plugins", func() {
 					ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
 					err := cniConfig.CheckNetworkList(ctx, netConfigList, runtimeConfig)
 					cancel()
-					Expect(err).To(MatchError(ContainSubstring("netplugin failed with no error message")))
+					Expect(err).To(MatchError(ContainSubstring("was killed: context deadline exceeded")))
 				})
 
 			})
@@ -1606,12 +1943,55 @@ var _ = Describe("Invoking plugins", func() {
 					ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
 					_, err := cniConfig.ValidateNetworkList(ctx, netConfigList)
 					cancel()
-					Expect(err).To(MatchError(ContainSubstring("netplugin failed with no error message")))
+					Expect(err).To(MatchError(ContainSubstring("was killed: context deadline exceeded")))
 				})
 
 			})
 		})
 
+		Describe("execTimeout", func() {
+			It("times out a single plugin", func() {
+				netConfig.ExecTimeout = 500 * time.Millisecond
+				_, err := cniConfig.AddNetwork(context.Background(), netConfig, runtimeConfig)
+				Expect(err).To(Equal(&libcni.TimeoutError{
+					Plugin:  "sleep",
+					Command: "ADD",
+					Timeout: 500 * time.Millisecond,
+				}))
+			})
+
+			It("reports timeouts as expired deadlines", func() {
+				netConfig.ExecTimeout = 500 * time.Millisecond
+				_, err := cniConfig.AddNetwork(context.Background(), netConfig, runtimeConfig)
+				Expect(err).To(BeAssignableToTypeOf(&libcni.TimeoutError{}))
+				Expect(err.(*libcni.TimeoutError).Unwrap()).To(Equal(context.DeadlineExceeded))
+			})
+
+			It("times out the plugins of a list using the list default", func() {
+				netConfigList, err := libcni.ConfListFromBytes([]byte(fmt.Sprintf(`{
+					"name": "some-list",
+					"cniVersion": "%s",
+					"execTimeout": "500ms",
+					"plugins": [ %s ]
+				}`, current.ImplementedSpecVersion, pluginConfig)))
+				Expect(err).NotTo(HaveOccurred())
+
+				err = cniConfig.DelNetworkList(context.Background(), netConfigList, runtimeConfig)
+				Expect(err).To(BeAssignableToTypeOf(&libcni.DelError{}))
+				perr := err.(*libcni.DelError).Unwrap().(*libcni.ListPluginError)
+				Expect(perr.Err).To(BeAssignableToTypeOf(&libcni.TimeoutError{}))
+				Expect(perr.Err).To(MatchError(`plugin "sleep" timed out after 500ms running DEL`))
+			})
+
+			It("reports the caller's deadline as before", func() {
+				netConfig.ExecTimeout = time.Minute
+				ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+				defer cancel()
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).To(MatchError(ContainSubstring("was killed: context deadline exceeded")))
+			})
+		})
+
 	})
 
 	Describe("Cache operations", func() {
@@ -1740,6 +2120,157 @@ var _ = Describe("Invoking plugins", func() {
 			Expect(foundCABytes).To(MatchJSON(expectedCABytes))
 		})
 
+		Describe("GarbageCollectCache", func() {
+			var deadRt *libcni.RuntimeConf
+
+			BeforeEach(func() {
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				deadRt = &libcni.RuntimeConf{
+					ContainerID: "dead-container-id",
+					NetNS:       netNS,
+					IfName:      firstIfname,
+					Args:        [][2]string{{"DEBUG", debugFilePath}},
+				}
+				_, err = cniConfig.AddNetwork(ctx, netConfig, deadRt)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("lists entries for containers that are no longer alive", func() {
+				stale, err := cniConfig.GarbageCollectCache(ctx, libcni.LiveContainers(containerID), libcni.CacheGCList)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stale).To(HaveLen(1))
+				Expect(stale[0].NetworkName).To(Equal(netName))
+				Expect(stale[0].ContainerID).To(Equal("dead-container-id"))
+				Expect(stale[0].IfName).To(Equal(firstIfname))
+
+				_, err = os.Stat(resultCacheFilePath(cacheDirPath, netName, deadRt))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("removes entries for containers that are no longer alive", func() {
+				stale, err := cniConfig.GarbageCollectCache(ctx, libcni.LiveContainers(containerID), libcni.CacheGCRemove)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stale).To(HaveLen(1))
+
+				_, err = os.Stat(resultCacheFilePath(cacheDirPath, netName, deadRt))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+				_, err = os.Stat(resultCacheFilePath(cacheDirPath, netName, runtimeConfig))
+				Expect(err).NotTo(HaveOccurred())
+
+				debug, err := noop_debug.ReadDebug(debugFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(debug.Command).To(Equal("ADD"))
+			})
+
+			It("executes DEL with the cached configuration for containers that are no longer alive", func() {
+				stale, err := cniConfig.GarbageCollectCache(ctx, func(id string) bool { return id == containerID }, libcni.CacheGCDelete)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stale).To(HaveLen(1))
+
+				debug, err := noop_debug.ReadDebug(debugFilePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(debug.Command).To(Equal("DEL"))
+				Expect(debug.CmdArgs.ContainerID).To(Equal("dead-container-id"))
+				Expect(debug.CmdArgs.IfName).To(Equal(firstIfname))
+
+				_, err = os.Stat(resultCacheFilePath(cacheDirPath, netName, deadRt))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		Describe("ListCachedAttachments", func() {
+			BeforeEach(func() {
+				_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				runtimeConfig.IfName = secondIfname
+				runtimeConfig.CapabilityArgs = map[string]interface{}{"foo": "bar"}
+				_, err = cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				runtimeConfig.ContainerID = "other-container-id"
+				_, err = cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns every cached attachment", func() {
+				attachments, err := cniConfig.ListCachedAttachments("", "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(attachments).To(HaveLen(3))
+			})
+
+			It("returns the attachments that could be read along with the errors of the others", func() {
+				brokenRt := &libcni.RuntimeConf{ContainerID: "broken-container-id", IfName: firstIfname}
+				Expect(ioutil.WriteFile(resultCacheFilePath(cacheDirPath, netName, brokenRt), []byte("adfadsfasdfasfdsafaf"), 0600)).To(Succeed())
+				legacyRt := &libcni.RuntimeConf{ContainerID: "legacy-container-id", IfName: firstIfname}
+				Expect(ioutil.WriteFile(resultCacheFilePath(cacheDirPath, netName, legacyRt), []byte(`{"cniVersion": "0.4.0"}`), 0600)).To(Succeed())
+
+				attachments, err := cniConfig.ListCachedAttachments("", "")
+				Expect(attachments).To(HaveLen(3))
+				Expect(err).To(BeAssignableToTypeOf(&libcni.CacheReadError{}))
+				readErr := err.(*libcni.CacheReadError)
+				Expect(readErr.Errors).To(HaveLen(2))
+				Expect(readErr.Errors).To(HaveKey(fmt.Sprintf("%s-broken-container-id-%s", netName, firstIfname)))
+				Expect(readErr.Errors).To(HaveKey(fmt.Sprintf("%s-legacy-container-id-%s", netName, firstIfname)))
+
+				// Entries of other networks and containers are not reported
+				attachments, err = cniConfig.ListCachedAttachments("some-other-net", "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(attachments).To(BeEmpty())
+				attachments, err = cniConfig.ListCachedAttachments(netName, containerID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(attachments).To(HaveLen(2))
+			})
+
+			It("returns attachments whose result cannot be parsed without a result", func() {
+				cacheFile := resultCacheFilePath(cacheDirPath, netName, runtimeConfig)
+				data, err := ioutil.ReadFile(cacheFile)
+				Expect(err).NotTo(HaveOccurred())
+				cached := map[string]interface{}{}
+				Expect(json.Unmarshal(data, &cached)).To(Succeed())
+				cached["result"] = map[string]interface{}{"cniVersion": "9.9.9"}
+				data, err = json.Marshal(cached)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(cacheFile, data, 0600)).To(Succeed())
+
+				attachments, err := cniConfig.ListCachedAttachments("", runtimeConfig.ContainerID)
+				Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("cache entry %q: failed to parse cached result", fmt.Sprintf("%s-%s-%s", netName, runtimeConfig.ContainerID, runtimeConfig.IfName)))))
+				Expect(attachments).To(HaveLen(1))
+				Expect(attachments[0].Result).To(BeNil())
+				Expect(attachments[0].IfName).To(Equal(runtimeConfig.IfName))
+			})
+
+			It("filters attachments by network and container", func() {
+				attachments, err := cniConfig.ListCachedAttachments("some-other-net", "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(attachments).To(BeEmpty())
+
+				attachments, err = cniConfig.ListCachedAttachments(netName, containerID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(attachments).To(HaveLen(2))
+				for _, att := range attachments {
+					Expect(att.NetworkName).To(Equal(netName))
+					Expect(att.ContainerID).To(Equal(containerID))
+					Expect(att.Config).To(MatchJSON(pluginConfig))
+					Expect(att.CniArgs).To(Equal([][2]string{{"DEBUG", debugFilePath}}))
+
+					result, err := current.GetResult(att.Result)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(result.IPs).To(HaveLen(1))
+					Expect(result.IPs[0].Address.String()).To(Equal(firstIP))
+
+					if att.IfName == secondIfname {
+						Expect(att.CapabilityArgs).To(Equal(map[string]interface{}{"foo": "bar"}))
+					} else {
+						Expect(att.IfName).To(Equal(firstIfname))
+						Expect(att.CapabilityArgs).To(BeNil())
+					}
+				}
+			})
+		})
+
 		Context("when the RuntimeConf is incomplete", func() {
 			var (
 				testRt          *libcni.RuntimeConf
@@ -1834,3 +2365,69 @@ var _ = Describe("Invoking plugins", func() {
 
 	})
 })
+
+var _ = Describe("Invoking plugins with a 1.0.0 configuration", func() {
+	var (
+		tmpDir        string
+		debugFilePath string
+		netConfigList *libcni.NetworkConfigList
+		runtimeConfig *libcni.RuntimeConf
+		cniConfig     *libcni.CNIConfig
+		ctx           context.Context
+	)
+
+	const ipResult = `{"cniVersion": "1.0.0", "ips": [{"address": "10.1.2.3/24"}], "dns": {}}`
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cni_100")
+		Expect(err).NotTo(HaveOccurred())
+
+		debugFilePath = filepath.Join(tmpDir, "debug")
+		debug := &noop_debug.Debug{ReportResult: ipResult}
+		Expect(debug.WriteDebug(debugFilePath)).To(Succeed())
+
+		netConfigList, err = libcni.ConfListFromBytes([]byte(fmt.Sprintf(`{
+			"name": "test100",
+			"cniVersion": "1.0.0",
+			"plugins": [{"type": "noop", "debugFile": %q}]
+		}`, debugFilePath)))
+		Expect(err).NotTo(HaveOccurred())
+
+		runtimeConfig = &libcni.RuntimeConf{
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns/path",
+			IfName:      "eth0",
+		}
+		cniConfig = libcni.NewCNIConfigWithCacheDir([]string{filepath.Dir(pluginPaths["noop"])}, tmpDir, nil)
+		ctx = context.TODO()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("adds, checks and deletes the attachment", func() {
+		_, err := cniConfig.ValidateNetworkList(ctx, netConfigList)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Version()).To(Equal("1.0.0"))
+		Expect(json.Marshal(result)).To(MatchJSON(ipResult))
+
+		cachedResult, err := cniConfig.GetNetworkListCachedResult(netConfigList, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Marshal(cachedResult)).To(MatchJSON(ipResult))
+
+		Expect(cniConfig.CheckNetworkList(ctx, netConfigList, runtimeConfig)).To(Succeed())
+		debug, err := noop_debug.ReadDebug(debugFilePath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(debug.Command).To(Equal("CHECK"))
+		stdin := map[string]interface{}{}
+		Expect(json.Unmarshal(debug.CmdArgs.StdinData, &stdin)).To(Succeed())
+		Expect(json.Marshal(stdin["prevResult"])).To(MatchJSON(ipResult))
+
+		Expect(cniConfig.DelNetworkList(ctx, netConfigList, runtimeConfig)).To(Succeed())
+	})
+})
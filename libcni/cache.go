@@ -0,0 +1,422 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CacheStore holds the data libcni caches for each attachment between
+// operations, such as the network configuration and result of an ADD.
+// Entries are opaque byte slices identified by a key that is unique to the
+// network name, container ID and interface name of the attachment.
+//
+// Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the data stored under key. If there is none, it returns
+	// an error for which os.IsNotExist() is true.
+	Get(key string) ([]byte, error)
+	// Put stores data under key, replacing any existing data.
+	Put(key string, data []byte) error
+	// Delete removes the data stored under key. If there is none, it
+	// returns an error for which os.IsNotExist() is true.
+	Delete(key string) error
+	// Keys returns the keys of all entries in the store.
+	Keys() ([]string, error)
+}
+
+// CacheLocker is implemented by CacheStores that can serialize operations on
+// an attachment between processes. CNIConfig holds the lock for an
+// attachment's key for the duration of each operation on it. For stores that
+// do not implement CacheLocker, operations are serialized within the current
+// process only.
+type CacheLocker interface {
+	// Lock blocks until it acquires an exclusive lock for key, and returns
+	// a function that releases it. If ctx is done first, it gives up and
+	// returns ctx.Err().
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+func cacheKeyNotFound(key string) error {
+	return &os.PathError{Op: "get", Path: key, Err: os.ErrNotExist}
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory as
+// path, flushes it to disk and renames it over path. Readers therefore see
+// either the old or the new contents of path, even if the system crashes
+// part way through.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// Removing the temporary file fails harmlessly once it has been renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself. Not all platforms can sync a directory,
+	// so errors here are ignored.
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// keyedMutex provides in-process mutual exclusion for arbitrary string keys
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*refMutex
+}
+
+// refMutex is a mutex, held by whoever managed to send to ch, that counts
+// the users waiting for it
+type refMutex struct {
+	ch   chan struct{}
+	refs int
+}
+
+// attachmentLocks serializes operations on attachments whose CacheStore does
+// not implement CacheLocker
+var attachmentLocks = &keyedMutex{}
+
+// lock blocks until it acquires the mutex for key or ctx is done, and
+// returns a function that releases the mutex
+func (k *keyedMutex) lock(ctx context.Context, key string) (func(), error) {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*refMutex)
+	}
+	m, ok := k.locks[key]
+	if !ok {
+		m = &refMutex{ch: make(chan struct{}, 1)}
+		k.locks[key] = m
+	}
+	m.refs++
+	k.mu.Unlock()
+
+	select {
+	case m.ch <- struct{}{}:
+	case <-ctx.Done():
+		k.release(key, m)
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-m.ch
+		k.release(key, m)
+	}, nil
+}
+
+func (k *keyedMutex) release(key string, m *refMutex) {
+	k.mu.Lock()
+	m.refs--
+	if m.refs == 0 {
+		delete(k.locks, key)
+	}
+	k.mu.Unlock()
+}
+
+// DirCacheStore is a CacheStore that keeps each entry in its own file,
+// named by the entry's key, in a single directory. It is the store used by
+// CNIConfig when no other is given. Entries are replaced atomically, and
+// attachments are locked with advisory file locks held on hidden files in
+// the same directory. On platforms without flock(), such as Windows, the
+// locks only serialize operations within the current process.
+type DirCacheStore struct {
+	Dir string
+}
+
+// DirCacheStore implements the CacheStore and CacheLocker interfaces
+var _ CacheStore = &DirCacheStore{}
+var _ CacheLocker = &DirCacheStore{}
+
+// NewDirCacheStore returns a CacheStore that keeps its entries as files in
+// the given directory, which is created when the first entry is stored.
+func NewDirCacheStore(dir string) *DirCacheStore {
+	return &DirCacheStore{Dir: dir}
+}
+
+func (s *DirCacheStore) Get(key string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.Dir, key))
+}
+
+func (s *DirCacheStore) Put(key string, data []byte) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.Dir, key), data, 0600)
+}
+
+func (s *DirCacheStore) Delete(key string) error {
+	return os.Remove(filepath.Join(s.Dir, key))
+}
+
+func (s *DirCacheStore) Keys() ([]string, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	switch {
+	case err == nil: // break
+	case os.IsNotExist(err):
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(files))
+	for _, f := range files {
+		// Skip lock files and temporary files left behind by a crash
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		keys = append(keys, f.Name())
+	}
+	return keys, nil
+}
+
+func (s *DirCacheStore) Lock(ctx context.Context, key string) (func(), error) {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return nil, err
+	}
+	return lockFile(ctx, filepath.Join(s.Dir, "."+key+".lock"))
+}
+
+// MemoryCacheStore is a CacheStore that keeps its entries in memory. It is
+// intended for tests, or for runtimes that do not need cached data to
+// survive a restart.
+type MemoryCacheStore struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+// MemoryCacheStore implements the CacheStore interface
+var _ CacheStore = &MemoryCacheStore{}
+
+// NewMemoryCacheStore returns an empty in-memory CacheStore
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{entries: make(map[string][]byte)}
+}
+
+func (s *MemoryCacheStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.entries[key]
+	if !ok {
+		return nil, cacheKeyNotFound(key)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *MemoryCacheStore) Put(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *MemoryCacheStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; !ok {
+		return cacheKeyNotFound(key)
+	}
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryCacheStore) Keys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+const fileCacheStoreKind = "cniCacheStoreV1"
+
+type fileCacheStoreData struct {
+	Kind    string            `json:"kind"`
+	Entries map[string][]byte `json:"entries"`
+}
+
+// FileCacheStore is a CacheStore that keeps all entries in a single file.
+// Every change rewrites the file to a temporary file which then replaces the
+// original, so the file always holds either the old or the new set of
+// entries. This avoids creating one file per attachment on hosts with many
+// attachments. Changes and attachments are locked with advisory file locks
+// held on hidden files next to the store. On platforms without flock(), such
+// as Windows, the locks only serialize access within the current process, so
+// the file must not be shared between processes there.
+type FileCacheStore struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// FileCacheStore implements the CacheStore and CacheLocker interfaces
+var _ CacheStore = &FileCacheStore{}
+var _ CacheLocker = &FileCacheStore{}
+
+// NewFileCacheStore returns a CacheStore that keeps its entries in the given
+// file, which is created when the first entry is stored.
+func NewFileCacheStore(path string) *FileCacheStore {
+	return &FileCacheStore{Path: path}
+}
+
+func (s *FileCacheStore) read() (*fileCacheStoreData, error) {
+	store := &fileCacheStoreData{
+		Kind:    fileCacheStoreKind,
+		Entries: make(map[string][]byte),
+	}
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cache store %s: %v", s.Path, err)
+	}
+	if store.Kind != fileCacheStoreKind {
+		return nil, fmt.Errorf("cache store %s has wrong kind: %v", s.Path, store.Kind)
+	}
+	if store.Entries == nil {
+		store.Entries = make(map[string][]byte)
+	}
+	return store, nil
+}
+
+func (s *FileCacheStore) write(store *fileCacheStoreData) error {
+	data, err := json.Marshal(store)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, data, 0600)
+}
+
+// lockPath returns the path of a lock file next to the store
+func (s *FileCacheStore) lockPath(name string) string {
+	return filepath.Join(filepath.Dir(s.Path), "."+filepath.Base(s.Path)+name+".lock")
+}
+
+// update applies fn to the current contents of the store and, if fn
+// succeeds, replaces the store with the result
+func (s *FileCacheStore) update(fn func(*fileCacheStoreData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return err
+	}
+	// Keep other processes from changing the file between read and write.
+	// The lock is only ever held briefly.
+	unlock, err := lockFile(context.Background(), s.lockPath(""))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	store, err := s.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(store); err != nil {
+		return err
+	}
+	return s.write(store)
+}
+
+func (s *FileCacheStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	data, ok := store.Entries[key]
+	if !ok {
+		return nil, cacheKeyNotFound(key)
+	}
+	return data, nil
+}
+
+func (s *FileCacheStore) Put(key string, data []byte) error {
+	return s.update(func(store *fileCacheStoreData) error {
+		store.Entries[key] = data
+		return nil
+	})
+}
+
+func (s *FileCacheStore) Delete(key string) error {
+	return s.update(func(store *fileCacheStoreData) error {
+		if _, ok := store.Entries[key]; !ok {
+			return cacheKeyNotFound(key)
+		}
+		delete(store.Entries, key)
+		return nil
+	})
+}
+
+func (s *FileCacheStore) Keys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(store.Entries))
+	for key := range store.Entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *FileCacheStore) Lock(ctx context.Context, key string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return nil, err
+	}
+	return lockFile(ctx, s.lockPath("-"+key))
+}
@@ -0,0 +1,246 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/types/current"
+	noop_debug "github.com/containernetworking/cni/plugins/test/noop/debug"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache stores", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cni_cachestore")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	stores := map[string]func() libcni.CacheStore{
+		"DirCacheStore": func() libcni.CacheStore {
+			return libcni.NewDirCacheStore(filepath.Join(tmpDir, "results"))
+		},
+		"MemoryCacheStore": func() libcni.CacheStore {
+			return libcni.NewMemoryCacheStore()
+		},
+		"FileCacheStore": func() libcni.CacheStore {
+			return libcni.NewFileCacheStore(filepath.Join(tmpDir, "cache.json"))
+		},
+	}
+
+	for name, newStore := range stores {
+		newStore := newStore
+
+		Describe(name, func() {
+			var store libcni.CacheStore
+
+			BeforeEach(func() {
+				store = newStore()
+			})
+
+			It("is empty before anything is stored", func() {
+				keys, err := store.Keys()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).To(BeEmpty())
+
+				_, err = store.Get("net-container-eth0")
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+
+			It("stores, replaces and deletes entries", func() {
+				Expect(store.Put("net-container-eth0", []byte(`{"a":1}`))).To(Succeed())
+				Expect(store.Put("net-container-eth1", []byte(`{"b":2}`))).To(Succeed())
+				Expect(store.Put("net-container-eth0", []byte(`{"a":3}`))).To(Succeed())
+
+				data, err := store.Get("net-container-eth0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(data).To(MatchJSON(`{"a":3}`))
+
+				keys, err := store.Keys()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).To(ConsistOf("net-container-eth0", "net-container-eth1"))
+
+				Expect(store.Delete("net-container-eth0")).To(Succeed())
+				_, err = store.Get("net-container-eth0")
+				Expect(os.IsNotExist(err)).To(BeTrue())
+				err = store.Delete("net-container-eth0")
+				Expect(os.IsNotExist(err)).To(BeTrue())
+
+				keys, err = store.Keys()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).To(ConsistOf("net-container-eth1"))
+			})
+		})
+	}
+
+	Describe("DirCacheStore", func() {
+		It("ignores hidden lock and temporary files", func() {
+			dir := filepath.Join(tmpDir, "results")
+			store := libcni.NewDirCacheStore(dir)
+			Expect(store.Put("net-container-eth0", []byte("data"))).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, ".net-container-eth1.tmp123"), []byte("{"), 0600)).To(Succeed())
+
+			keys, err := store.Keys()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(Equal([]string{"net-container-eth0"}))
+		})
+
+		It("serializes holders of the same lock", func() {
+			store := libcni.NewDirCacheStore(filepath.Join(tmpDir, "results"))
+			unlock, err := store.Lock(context.TODO(), "net-container-eth0")
+			Expect(err).NotTo(HaveOccurred())
+
+			locked := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				unlock2, err := store.Lock(context.TODO(), "net-container-eth0")
+				Expect(err).NotTo(HaveOccurred())
+				close(locked)
+				unlock2()
+			}()
+
+			Consistently(locked, "200ms").ShouldNot(BeClosed())
+			unlock()
+			Eventually(locked).Should(BeClosed())
+		})
+
+		It("gives up waiting for a lock when the context is done", func() {
+			store := libcni.NewDirCacheStore(filepath.Join(tmpDir, "results"))
+			unlock, err := store.Lock(context.TODO(), "net-container-eth0")
+			Expect(err).NotTo(HaveOccurred())
+			defer unlock()
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+			defer cancel()
+			_, err = store.Lock(ctx, "net-container-eth0")
+			Expect(err).To(Equal(context.DeadlineExceeded))
+		})
+	})
+
+	Describe("FileCacheStore", func() {
+		It("shares entries with other stores using the same file", func() {
+			path := filepath.Join(tmpDir, "cache.json")
+			Expect(libcni.NewFileCacheStore(path).Put("net-container-eth0", []byte("data"))).To(Succeed())
+
+			data, err := libcni.NewFileCacheStore(path).Get("net-container-eth0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("data"))
+
+			files, err := ioutil.ReadDir(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(1))
+		})
+
+		It("returns an error when the file is corrupt", func() {
+			path := filepath.Join(tmpDir, "cache.json")
+			Expect(ioutil.WriteFile(path, []byte("asdfasdf"), 0600)).To(Succeed())
+
+			_, err := libcni.NewFileCacheStore(path).Get("net-container-eth0")
+			Expect(err).To(MatchError(ContainSubstring("failed to unmarshal cache store")))
+		})
+	})
+
+	Describe("CNIConfig with a cache store", func() {
+		It("caches results in the given store", func() {
+			debugFilePath := filepath.Join(tmpDir, "debug")
+			debug := &noop_debug.Debug{
+				ReportResult: `{"cniVersion": "0.4.0", "ips": [{"version": "4", "address": "10.1.2.3/24"}]}`,
+			}
+			Expect(debug.WriteDebug(debugFilePath)).To(Succeed())
+
+			netConfig, err := libcni.ConfFromBytes([]byte(fmt.Sprintf(`{
+				"type": "noop",
+				"name": "storetest",
+				"cniVersion": "%s"
+			}`, current.ImplementedSpecVersion)))
+			Expect(err).NotTo(HaveOccurred())
+			rt := &libcni.RuntimeConf{
+				ContainerID: "some-container-id",
+				NetNS:       "/some/netns/path",
+				IfName:      "eth0",
+				Args:        [][2]string{{"DEBUG", debugFilePath}},
+				CacheDir:    filepath.Join(tmpDir, "ignored"),
+			}
+
+			store := libcni.NewMemoryCacheStore()
+			cniConfig := libcni.NewCNIConfigWithCacheStore([]string{filepath.Dir(pluginPaths["noop"])}, store, nil)
+			_, err = cniConfig.AddNetwork(context.TODO(), netConfig, rt)
+			Expect(err).NotTo(HaveOccurred())
+
+			// The store takes precedence over the RuntimeConf's CacheDir
+			_, err = os.Stat(rt.CacheDir)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+
+			keys, err := store.Keys()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(Equal([]string{"storetest-some-container-id-eth0"}))
+
+			cachedResult, err := cniConfig.GetNetworkCachedResult(netConfig, rt)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cachedResult).NotTo(BeNil())
+
+			Expect(cniConfig.DelNetwork(context.TODO(), netConfig, rt)).To(Succeed())
+			keys, err = store.Keys()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(BeEmpty())
+		})
+
+		It("leaves only the result file behind in the default store", func() {
+			debugFilePath := filepath.Join(tmpDir, "debug")
+			debug := &noop_debug.Debug{
+				ReportResult: `{"cniVersion": "0.4.0", "ips": [{"version": "4", "address": "10.1.2.3/24"}]}`,
+			}
+			Expect(debug.WriteDebug(debugFilePath)).To(Succeed())
+
+			netConfig, err := libcni.ConfFromBytes([]byte(fmt.Sprintf(`{
+				"type": "noop",
+				"name": "storetest",
+				"cniVersion": "%s"
+			}`, current.ImplementedSpecVersion)))
+			Expect(err).NotTo(HaveOccurred())
+			rt := &libcni.RuntimeConf{
+				ContainerID: "some-container-id",
+				NetNS:       "/some/netns/path",
+				IfName:      "eth0",
+				Args:        [][2]string{{"DEBUG", debugFilePath}},
+			}
+
+			cacheDir := filepath.Join(tmpDir, "cache")
+			cniConfig := libcni.NewCNIConfigWithCacheDir([]string{filepath.Dir(pluginPaths["noop"])}, cacheDir, nil)
+			_, err = cniConfig.AddNetwork(context.TODO(), netConfig, rt)
+			Expect(err).NotTo(HaveOccurred())
+
+			files, err := ioutil.ReadDir(filepath.Join(cacheDir, "results"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(1))
+			Expect(files[0].Name()).To(Equal("storetest-some-container-id-eth0"))
+		})
+	})
+})
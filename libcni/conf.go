@@ -21,6 +21,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"time"
 )
 
 type NotFoundError struct {
@@ -40,6 +41,26 @@ func (e NoConfigsFoundError) Error() string {
 	return fmt.Sprintf(`no net configurations found in %s`, e.Dir)
 }
 
+// parseExecTimeout parses the optional "execTimeout" key of a network
+// configuration or configuration list, a duration string such as "30s"
+func parseExecTimeout(raw interface{}) (time.Duration, error) {
+	if raw == nil {
+		return 0, nil
+	}
+	str, ok := raw.(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid execTimeout type %T", raw)
+	}
+	timeout, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid execTimeout: %v", err)
+	}
+	if timeout < 0 {
+		return 0, fmt.Errorf("invalid execTimeout: %q is negative", str)
+	}
+	return timeout, nil
+}
+
 func ConfFromBytes(bytes []byte) (*NetworkConfig, error) {
 	conf := &NetworkConfig{Bytes: bytes}
 	if err := json.Unmarshal(bytes, &conf.Network); err != nil {
@@ -48,6 +69,19 @@ func ConfFromBytes(bytes []byte) (*NetworkConfig, error) {
 	if conf.Network.Type == "" {
 		return nil, fmt.Errorf("error parsing configuration: missing 'type'")
 	}
+
+	var libcniConf struct {
+		ExecTimeout interface{} `json:"execTimeout"`
+	}
+	if err := json.Unmarshal(bytes, &libcniConf); err != nil {
+		return nil, fmt.Errorf("error parsing configuration: %s", err)
+	}
+	timeout, err := parseExecTimeout(libcniConf.ExecTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing configuration: %s", err)
+	}
+	conf.ExecTimeout = timeout
+
 	return conf, nil
 }
 
@@ -83,6 +117,21 @@ func ConfListFromBytes(bytes []byte) (*NetworkConfigList, error) {
 		}
 	}
 
+	var cniVersions []string
+	if rawVersions, ok := rawList["cniVersions"]; ok {
+		versions, ok := rawVersions.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("error parsing configuration list: invalid cniVersions type %T", rawVersions)
+		}
+		for _, rawVersion := range versions {
+			v, ok := rawVersion.(string)
+			if !ok {
+				return nil, fmt.Errorf("error parsing configuration list: invalid cniVersions entry type %T", rawVersion)
+			}
+			cniVersions = append(cniVersions, v)
+		}
+	}
+
 	disableCheck := false
 	if rawDisableCheck, ok := rawList["disableCheck"]; ok {
 		disableCheck, ok = rawDisableCheck.(bool)
@@ -91,10 +140,17 @@ func ConfListFromBytes(bytes []byte) (*NetworkConfigList, error) {
 		}
 	}
 
+	execTimeout, err := parseExecTimeout(rawList["execTimeout"])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing configuration list: %s", err)
+	}
+
 	list := &NetworkConfigList{
 		Name:         name,
 		DisableCheck: disableCheck,
 		CNIVersion:   cniVersion,
+		CNIVersions:  cniVersions,
+		ExecTimeout:  execTimeout,
 		Bytes:        bytes,
 	}
 
@@ -120,6 +176,10 @@ func ConfListFromBytes(bytes []byte) (*NetworkConfigList, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse plugin config %d: %v", i, err)
 		}
+		// An explicit "0s" disables the list's default
+		if rawConf, _ := conf.(map[string]interface{}); rawConf["execTimeout"] == nil {
+			netConf.ExecTimeout = list.ExecTimeout
+		}
 		list.Plugins = append(list.Plugins, netConf)
 	}
 
@@ -18,6 +18,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/containernetworking/cni/libcni"
 	"github.com/containernetworking/cni/pkg/types"
@@ -186,6 +187,56 @@ var _ = Describe("Loading configuration from disk", func() {
 				Expect(err).To(MatchError(`error parsing configuration: missing 'type'`))
 			})
 		})
+
+		Context("when the config has an execTimeout", func() {
+			It("parses the duration", func() {
+				conf, err := libcni.ConfFromBytes([]byte(`{ "name": "some-plugin", "type": "foobar", "execTimeout": "1m30s" }`))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conf.ExecTimeout).To(Equal(90 * time.Second))
+			})
+
+			It("returns a useful error when it is not a duration", func() {
+				_, err := libcni.ConfFromBytes([]byte(`{ "name": "some-plugin", "type": "foobar", "execTimeout": 30 }`))
+				Expect(err).To(MatchError(`error parsing configuration: invalid execTimeout type float64`))
+
+				_, err = libcni.ConfFromBytes([]byte(`{ "name": "some-plugin", "type": "foobar", "execTimeout": "-5s" }`))
+				Expect(err).To(MatchError(`error parsing configuration: invalid execTimeout: "-5s" is negative`))
+			})
+		})
+	})
+
+	Describe("ConfListFromBytes", func() {
+		Context("when the list has an execTimeout", func() {
+			It("applies it to plugins without their own", func() {
+				list, err := libcni.ConfListFromBytes([]byte(`{
+					"name": "some-list",
+					"execTimeout": "10s",
+					"plugins": [
+						{ "type": "foo" },
+						{ "type": "bar", "execTimeout": "2s" }
+					]
+				}`))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(list.ExecTimeout).To(Equal(10 * time.Second))
+				Expect(list.Plugins[0].ExecTimeout).To(Equal(10 * time.Second))
+				Expect(list.Plugins[1].ExecTimeout).To(Equal(2 * time.Second))
+			})
+
+			It("does not apply it to plugins that disable their timeout", func() {
+				list, err := libcni.ConfListFromBytes([]byte(`{
+					"name": "some-list",
+					"execTimeout": "10s",
+					"plugins": [ { "type": "foo", "execTimeout": "0s" } ]
+				}`))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(list.Plugins[0].ExecTimeout).To(BeZero())
+			})
+
+			It("returns a useful error when it is not a duration", func() {
+				_, err := libcni.ConfListFromBytes([]byte(`{ "name": "some-list", "execTimeout": "soon", "plugins": [ { "type": "foo" } ] }`))
+				Expect(err).To(MatchError(ContainSubstring(`error parsing configuration list: invalid execTimeout`)))
+			})
+		})
 	})
 
 	Describe("LoadConfList", func() {
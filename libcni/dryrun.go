@@ -0,0 +1,124 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/utils"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// DryRunNetworkList returns the plugin invocations that AddNetworkList,
+// CheckNetworkList or DelNetworkList would make for the given command,
+// in the order they would be made, without executing any plugin. Each
+// invocation holds the resolved plugin path, the exact network
+// configuration the plugin would be sent on stdin, and its environment.
+//
+// CHECK and DEL are given the cached result of the attachment as prevResult,
+// as they would be. On ADD each plugin is given the result of the previous
+// one, which cannot be known without running it, so prevResult is omitted
+// from the invocations of all but the first plugin.
+func (c *CNIConfig) DryRunNetworkList(command string, list *NetworkConfigList, rt *RuntimeConf) ([]*PluginInvocation, error) {
+	var cachedResult types.Result
+	plugins := list.Plugins
+
+	switch command {
+	case "ADD":
+		if err := utils.ValidateContainerID(rt.ContainerID); err != nil {
+			return nil, err
+		}
+		if err := utils.ValidateNetworkName(list.Name); err != nil {
+			return nil, err
+		}
+		if err := utils.ValidateInterfaceName(rt.IfName); err != nil {
+			return nil, err
+		}
+	case "CHECK":
+		// CHECK was added in CNI spec version 0.4.0 and higher
+		if gtet, err := version.GreaterThanOrEqualTo(list.CNIVersion, "0.4.0"); err != nil {
+			return nil, err
+		} else if !gtet {
+			return nil, fmt.Errorf("configuration version %q does not support the CHECK command", list.CNIVersion)
+		}
+		if list.DisableCheck {
+			return []*PluginInvocation{}, nil
+		}
+		var err error
+		cachedResult, err = c.getCachedResult(list.Name, list.CNIVersion, rt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get network %q cached result: %v", list.Name, err)
+		}
+	case "DEL":
+		// Cached result on DEL was added in CNI spec version 0.4.0 and higher
+		if gtet, err := version.GreaterThanOrEqualTo(list.CNIVersion, "0.4.0"); err != nil {
+			return nil, err
+		} else if gtet {
+			cachedResult, err = c.getCachedResult(list.Name, list.CNIVersion, rt)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get network %q cached result: %v", list.Name, err)
+			}
+		}
+		plugins = make([]*NetworkConfig, 0, len(list.Plugins))
+		for i := len(list.Plugins) - 1; i >= 0; i-- {
+			plugins = append(plugins, list.Plugins[i])
+		}
+	default:
+		return nil, fmt.Errorf("unsupported command %q", command)
+	}
+
+	invocations := make([]*PluginInvocation, 0, len(plugins))
+	for _, net := range plugins {
+		inv, err := c.renderInvocation(command, list.Name, list.CNIVersion, net, cachedResult, rt)
+		if err != nil {
+			return nil, err
+		}
+		invocations = append(invocations, inv)
+	}
+	return invocations, nil
+}
+
+// DryRunNetwork is like DryRunNetworkList for a single network configuration
+func (c *CNIConfig) DryRunNetwork(command string, net *NetworkConfig, rt *RuntimeConf) ([]*PluginInvocation, error) {
+	list, err := ConfListFromConf(net)
+	if err != nil {
+		return nil, err
+	}
+	return c.DryRunNetworkList(command, list, rt)
+}
+
+// renderInvocation builds the invocation of a plugin the same way addNetwork,
+// checkNetwork and delNetwork do, without executing it
+func (c *CNIConfig) renderInvocation(command, name, cniVersion string, net *NetworkConfig, prevResult types.Result, rt *RuntimeConf) (*PluginInvocation, error) {
+	pluginPath, err := c.findInPath(net.Network.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	newConf, err := buildOneConfig(name, cniVersion, net, prevResult, rt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PluginInvocation{
+		Command:     command,
+		NetworkName: name,
+		PluginType:  net.Network.Type,
+		PluginPath:  pluginPath,
+		StdinData:   newConf.Bytes,
+		Environ:     c.args(command, rt).AsEnv(),
+	}, nil
+}
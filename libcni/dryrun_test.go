@@ -0,0 +1,147 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/libcni"
+	noop_debug "github.com/containernetworking/cni/plugins/test/noop/debug"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dry runs", func() {
+	var (
+		tmpDir        string
+		debugFilePath string
+		netConfigList *libcni.NetworkConfigList
+		runtimeConfig *libcni.RuntimeConf
+		cniConfig     *libcni.CNIConfig
+	)
+
+	const ipResult = `{"cniVersion": "0.4.0", "ips": [{"version": "4", "address": "10.1.2.3/24"}], "dns": {}}`
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cni_dryrun")
+		Expect(err).NotTo(HaveOccurred())
+
+		debugFilePath = filepath.Join(tmpDir, "debug")
+		debug := &noop_debug.Debug{ReportResult: ipResult}
+		Expect(debug.WriteDebug(debugFilePath)).To(Succeed())
+
+		netConfigList, err = libcni.ConfListFromBytes([]byte(fmt.Sprintf(`{
+			"name": "dryruntest",
+			"cniVersion": "0.4.0",
+			"plugins": [
+				{"type": "noop", "debugFile": %q, "capabilities": {"portMappings": true}},
+				{"type": "noop", "debugFile": %q, "some-key": "some-value"}
+			]
+		}`, debugFilePath, debugFilePath)))
+		Expect(err).NotTo(HaveOccurred())
+
+		runtimeConfig = &libcni.RuntimeConf{
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns/path",
+			IfName:      "eth0",
+			Args:        [][2]string{{"FOO", "BAR"}},
+			CapabilityArgs: map[string]interface{}{
+				"portMappings": []map[string]interface{}{
+					{"hostPort": 8080, "containerPort": 80, "protocol": "tcp"},
+				},
+			},
+		}
+
+		cniConfig = libcni.NewCNIConfigWithCacheDir([]string{filepath.Dir(pluginPaths["noop"])}, tmpDir, nil)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	stdinOf := func(inv *libcni.PluginInvocation) map[string]interface{} {
+		conf := map[string]interface{}{}
+		Expect(json.Unmarshal(inv.StdinData, &conf)).To(Succeed())
+		return conf
+	}
+
+	It("renders ADD without running any plugin", func() {
+		invocations, err := cniConfig.DryRunNetworkList("ADD", netConfigList, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(invocations).To(HaveLen(2))
+
+		for _, inv := range invocations {
+			Expect(inv.Command).To(Equal("ADD"))
+			Expect(inv.NetworkName).To(Equal("dryruntest"))
+			Expect(inv.PluginType).To(Equal("noop"))
+			Expect(inv.PluginPath).To(Equal(pluginPaths["noop"]))
+			Expect(inv.Environ).To(ContainElement("CNI_COMMAND=ADD"))
+			Expect(inv.Environ).To(ContainElement("CNI_CONTAINERID=some-container-id"))
+			Expect(inv.Environ).To(ContainElement("CNI_ARGS=FOO=BAR"))
+		}
+
+		// Only the first plugin asked for portMappings
+		Expect(stdinOf(invocations[0])).To(HaveKeyWithValue("runtimeConfig", map[string]interface{}{
+			"portMappings": []interface{}{
+				map[string]interface{}{"hostPort": float64(8080), "containerPort": float64(80), "protocol": "tcp"},
+			},
+		}))
+		Expect(stdinOf(invocations[1])).NotTo(HaveKey("runtimeConfig"))
+		Expect(stdinOf(invocations[1])).To(HaveKeyWithValue("some-key", "some-value"))
+
+		debug, err := noop_debug.ReadDebug(debugFilePath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(debug.Command).To(BeEmpty())
+	})
+
+	It("renders DEL in reverse order with the cached result", func() {
+		_, err := cniConfig.AddNetworkList(context.TODO(), netConfigList, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		invocations, err := cniConfig.DryRunNetworkList("DEL", netConfigList, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(invocations).To(HaveLen(2))
+		Expect(stdinOf(invocations[0])).To(HaveKeyWithValue("some-key", "some-value"))
+		for _, inv := range invocations {
+			Expect(inv.Command).To(Equal("DEL"))
+			Expect(inv.Environ).To(ContainElement("CNI_COMMAND=DEL"))
+			prevResult, err := json.Marshal(stdinOf(inv)["prevResult"])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prevResult).To(MatchJSON(ipResult))
+		}
+	})
+
+	It("renders CHECK without a prevResult when nothing is cached", func() {
+		invocations, err := cniConfig.DryRunNetworkList("CHECK", netConfigList, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(invocations).To(HaveLen(2))
+		for _, inv := range invocations {
+			Expect(inv.Command).To(Equal("CHECK"))
+			Expect(stdinOf(inv)).NotTo(HaveKey("prevResult"))
+		}
+	})
+
+	It("rejects unknown commands", func() {
+		_, err := cniConfig.DryRunNetworkList("VERSION", netConfigList, runtimeConfig)
+		Expect(err).To(MatchError(`unsupported command "VERSION"`))
+	})
+})
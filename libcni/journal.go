@@ -0,0 +1,353 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+const (
+	CNIJournalV1 = "cniJournalV1"
+)
+
+// JournalEntry records an ADD or DEL operation that is in progress, so that
+// it can be completed or undone by RecoverJournal if the runtime exits before
+// the operation returns.
+type JournalEntry struct {
+	Kind        string `json:"kind"`
+	Command     string `json:"command"`
+	NetworkName string `json:"networkName"`
+	ContainerID string `json:"containerId"`
+	IfName      string `json:"ifName"`
+	NetNS       string `json:"netns"`
+	// Config is the network configuration or configuration list of the
+	// operation
+	Config         []byte                 `json:"config"`
+	CniArgs        [][2]string            `json:"cniArgs,omitempty"`
+	CapabilityArgs map[string]interface{} `json:"capabilityArgs,omitempty"`
+	// Completed is the number of plugins that have finished successfully.
+	// DEL runs plugins in reverse order, so for DEL these are the last
+	// Completed plugins of the list.
+	Completed int `json:"completed"`
+	// PrevResults holds, for ADD, the prevResult given to each plugin that
+	// has been started. For DEL it holds the single cached result given to
+	// every plugin.
+	PrevResults []json.RawMessage `json:"prevResults,omitempty"`
+}
+
+// journalRecord keeps the journal entry of one operation up to date. A nil
+// journalRecord, used when journaling is disabled, does nothing.
+type journalRecord struct {
+	store CacheStore
+	key   string
+	entry *JournalEntry
+	// kept is set when the operation could not be undone, so that finish
+	// leaves the entry for RecoverJournal
+	kept bool
+}
+
+// journalBegin writes a journal entry for an operation that is about to run
+// its first plugin
+func (c *CNIConfig) journalBegin(command, netName string, config []byte, prevResult types.Result, rt *RuntimeConf) (*journalRecord, error) {
+	if c.Journal == nil {
+		return nil, nil
+	}
+	key, err := getCacheKey(netName, rt)
+	if err != nil {
+		return nil, err
+	}
+	j := &journalRecord{
+		store: c.Journal,
+		key:   key,
+		entry: &JournalEntry{
+			Kind:           CNIJournalV1,
+			Command:        command,
+			NetworkName:    netName,
+			ContainerID:    rt.ContainerID,
+			IfName:         rt.IfName,
+			NetNS:          rt.NetNS,
+			Config:         config,
+			CniArgs:        rt.Args,
+			CapabilityArgs: rt.CapabilityArgs,
+		},
+	}
+	if err := j.appendResult(prevResult); err != nil {
+		return nil, err
+	}
+	if err := j.write(); err != nil {
+		return nil, fmt.Errorf("failed to write network %q journal entry: %v", netName, err)
+	}
+	return j, nil
+}
+
+func (j *journalRecord) appendResult(result types.Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	j.entry.PrevResults = append(j.entry.PrevResults, data)
+	return nil
+}
+
+func (j *journalRecord) write() error {
+	data, err := json.Marshal(j.entry)
+	if err != nil {
+		return err
+	}
+	return j.store.Put(j.key, data)
+}
+
+// addCompleted records that the next plugin of an ADD returned result, which
+// becomes the prevResult of the plugin after it
+func (j *journalRecord) addCompleted(result types.Result) error {
+	if j == nil {
+		return nil
+	}
+	j.entry.Completed++
+	if err := j.appendResult(result); err != nil {
+		return err
+	}
+	if err := j.write(); err != nil {
+		return fmt.Errorf("failed to write network %q journal entry: %v", j.entry.NetworkName, err)
+	}
+	return nil
+}
+
+// delCompleted records that the next plugin of a DEL finished
+func (j *journalRecord) delCompleted() error {
+	if j == nil {
+		return nil
+	}
+	j.entry.Completed++
+	if err := j.write(); err != nil {
+		return fmt.Errorf("failed to write network %q journal entry: %v", j.entry.NetworkName, err)
+	}
+	return nil
+}
+
+// keep makes finish leave the journal entry in place, for an operation that
+// failed and could not be undone
+func (j *journalRecord) keep() {
+	if j == nil {
+		return
+	}
+	j.kept = true
+}
+
+// finish removes the journal entry once the operation has returned to the
+// caller, who from then on is responsible for its outcome. An entry that is
+// kept stays for RecoverJournal to finish.
+func (j *journalRecord) finish() error {
+	if j == nil || j.kept {
+		return nil
+	}
+	if err := j.store.Delete(j.key); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove network %q journal entry: %v", j.entry.NetworkName, err)
+	}
+	return nil
+}
+
+// resultFromBytes parses a result in whatever CNI version it was encoded in.
+// A JSON null yields a nil result.
+func resultFromBytes(data []byte) (types.Result, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	decoder := version.ConfigDecoder{}
+	resultCniVersion, err := decoder.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return version.NewResult(resultCniVersion, data)
+}
+
+// ListJournal returns the operations currently recorded in the journal
+func (c *CNIConfig) ListJournal() ([]*JournalEntry, error) {
+	if c.Journal == nil {
+		return nil, nil
+	}
+	keys, err := c.Journal.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*JournalEntry, 0, len(keys))
+	for _, key := range keys {
+		entry, err := c.readJournalEntry(key)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (c *CNIConfig) readJournalEntry(key string) (*JournalEntry, error) {
+	data, err := c.Journal.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	entry := &JournalEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal journal entry %q: %v", key, err)
+	}
+	if entry.Kind != CNIJournalV1 {
+		return nil, fmt.Errorf("journal entry %q has wrong kind: %v", key, entry.Kind)
+	}
+	return entry, nil
+}
+
+// RecoverJournal finishes the operations recorded in the journal, which were
+// interrupted because the runtime exited before they returned. It is
+// intended to be called once when the runtime starts, before it begins new
+// operations.
+//
+// Interrupted DEL operations are completed by running DEL on the plugins
+// that had not yet finished. Interrupted ADD operations are rolled back,
+// because the runtime never received their result: DEL is run in reverse
+// order on every plugin that was started, and any cached result is removed.
+// The journal entry of an operation is removed once it has been recovered.
+//
+// RecoverJournal returns the entries it processed. It continues past
+// failures, leaving the entries that could not be recovered in the journal,
+// and returns any errors together.
+func (c *CNIConfig) RecoverJournal(ctx context.Context) ([]*JournalEntry, error) {
+	if c.Journal == nil {
+		return nil, nil
+	}
+	keys, err := c.Journal.Keys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %v", err)
+	}
+
+	recovered := []*JournalEntry{}
+	errs := []error{}
+	for _, key := range keys {
+		entry, err := c.recoverJournalEntry(ctx, key)
+		if entry != nil {
+			recovered = append(recovered, entry)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return recovered, fmt.Errorf("%v", errs)
+	}
+	return recovered, nil
+}
+
+func (c *CNIConfig) recoverJournalEntry(ctx context.Context, key string) (*JournalEntry, error) {
+	entry, err := c.readJournalEntry(key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	rt := &RuntimeConf{
+		ContainerID:    entry.ContainerID,
+		NetNS:          entry.NetNS,
+		IfName:         entry.IfName,
+		Args:           entry.CniArgs,
+		CapabilityArgs: entry.CapabilityArgs,
+	}
+	unlock, err := c.lockAttachment(ctx, entry.NetworkName, rt)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// The operation may have finished while we waited for the lock
+	entry, err = c.readJournalEntry(key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if err := c.replayJournalEntry(ctx, entry, rt); err != nil {
+		return entry, fmt.Errorf("failed to recover %s of network %q for container %q interface %q: %v", entry.Command, entry.NetworkName, entry.ContainerID, entry.IfName, err)
+	}
+	if err := c.Journal.Delete(key); err != nil && !os.IsNotExist(err) {
+		return entry, err
+	}
+	return entry, nil
+}
+
+func (c *CNIConfig) replayJournalEntry(ctx context.Context, entry *JournalEntry, rt *RuntimeConf) error {
+	list, err := confListFromCachedConfig(entry.Config)
+	if err != nil {
+		return err
+	}
+	if len(list.Plugins) == 0 {
+		return nil
+	}
+
+	prevResults := make([]types.Result, 0, len(entry.PrevResults))
+	for _, data := range entry.PrevResults {
+		result, err := resultFromBytes(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse journaled result: %v", err)
+		}
+		prevResults = append(prevResults, result)
+	}
+
+	switch entry.Command {
+	case "ADD":
+		// Also roll back the plugin that was running, if any, since it
+		// may have done part of its work
+		started := entry.Completed + 1
+		if started > len(list.Plugins) {
+			started = len(list.Plugins)
+		}
+		if started > len(prevResults) {
+			started = len(prevResults)
+		}
+		if errs := c.delPlugins(ctx, list, started, rt, addPrevResults(list, prevResults), nil); len(errs) > 0 {
+			return fmt.Errorf("%v", errs)
+		}
+		if err := c.cacheDel(list.Name, rt); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	case "DEL":
+		var cachedResult types.Result
+		if len(prevResults) > 0 {
+			cachedResult = prevResults[0]
+		}
+		for i := len(list.Plugins) - 1 - entry.Completed; i >= 0; i-- {
+			net := list.Plugins[i]
+			if err := c.delNetwork(ctx, list.Name, list.CNIVersion, net, cachedResult, rt); err != nil {
+				return err
+			}
+		}
+		_ = c.cacheDel(list.Name, rt)
+	default:
+		return fmt.Errorf("unknown command %q", entry.Command)
+	}
+	return nil
+}
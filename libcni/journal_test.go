@@ -0,0 +1,282 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/skel"
+	noop_debug "github.com/containernetworking/cni/plugins/test/noop/debug"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// undeletableStore is a CacheStore whose entries cannot be removed while
+// failDelete is set
+type undeletableStore struct {
+	*libcni.MemoryCacheStore
+
+	mu         sync.Mutex
+	failDelete bool
+}
+
+func (s *undeletableStore) setFailDelete(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failDelete = fail
+}
+
+func (s *undeletableStore) Delete(key string) error {
+	s.mu.Lock()
+	fail := s.failDelete
+	s.mu.Unlock()
+	if fail {
+		return fmt.Errorf("cannot delete %s", key)
+	}
+	return s.MemoryCacheStore.Delete(key)
+}
+
+var _ = Describe("Operation journal", func() {
+	var (
+		tmpDir        string
+		debugFiles    []string
+		netConfigList *libcni.NetworkConfigList
+		runtimeConfig *libcni.RuntimeConf
+		journal       *libcni.MemoryCacheStore
+		cniConfig     *libcni.CNIConfig
+		ctx           context.Context
+	)
+
+	const ipResult = `{"cniVersion": "0.4.0", "ips": [{"version": "4", "address": "10.1.2.3/24"}]}`
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cni_journal")
+		Expect(err).NotTo(HaveOccurred())
+
+		debugFiles = []string{filepath.Join(tmpDir, "debug-0"), filepath.Join(tmpDir, "debug-1")}
+		for _, debugFile := range debugFiles {
+			debug := &noop_debug.Debug{ReportResult: ipResult}
+			Expect(debug.WriteDebug(debugFile)).To(Succeed())
+		}
+
+		netConfigList, err = libcni.ConfListFromBytes([]byte(fmt.Sprintf(`{
+			"name": "journaltest",
+			"cniVersion": "0.4.0",
+			"plugins": [
+				{"type": "noop", "debugFile": %q},
+				{"type": "noop", "debugFile": %q}
+			]
+		}`, debugFiles[0], debugFiles[1])))
+		Expect(err).NotTo(HaveOccurred())
+
+		runtimeConfig = &libcni.RuntimeConf{
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns/path",
+			IfName:      "eth0",
+		}
+
+		journal = libcni.NewMemoryCacheStore()
+		cniConfig = libcni.NewCNIConfigWithCacheDir([]string{filepath.Dir(pluginPaths["noop"])}, filepath.Join(tmpDir, "cache"), nil)
+		cniConfig.Journal = journal
+		ctx = context.TODO()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	readDebug := func(i int) *noop_debug.Debug {
+		debug, err := noop_debug.ReadDebug(debugFiles[i])
+		Expect(err).NotTo(HaveOccurred())
+		return debug
+	}
+
+	writeEntry := func(entry *libcni.JournalEntry) {
+		entry.Kind = libcni.CNIJournalV1
+		entry.NetworkName = netConfigList.Name
+		entry.ContainerID = runtimeConfig.ContainerID
+		entry.IfName = runtimeConfig.IfName
+		entry.NetNS = runtimeConfig.NetNS
+		entry.Config = netConfigList.Bytes
+		data, err := json.Marshal(entry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(journal.Put("journaltest-some-container-id-eth0", data)).To(Succeed())
+	}
+
+	It("removes the journal entry when an operation returns", func() {
+		_, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		entries, err := cniConfig.ListJournal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+
+		Expect(cniConfig.DelNetworkList(ctx, netConfigList, runtimeConfig)).To(Succeed())
+		entries, err = cniConfig.ListJournal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("rolls back an ADD whose journal entry cannot be removed", func() {
+		store := &undeletableStore{MemoryCacheStore: journal, failDelete: true}
+		cniConfig.Journal = store
+		cniConfig.RollbackOnFailure = true
+
+		_, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+		Expect(err).To(MatchError(ContainSubstring("cannot delete")))
+		_, ok := err.(*libcni.RollbackError)
+		Expect(ok).To(BeTrue())
+
+		for i := range debugFiles {
+			Expect(readDebug(i).Command).To(Equal("DEL"))
+		}
+		cachedResult, err := cniConfig.GetNetworkListCachedResult(netConfigList, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cachedResult).To(BeNil())
+	})
+
+	It("keeps the journal entry of an ADD whose rollback failed", func() {
+		// The first plugin cannot be deleted until the runtime restarts
+		delFails := true
+		exec := invoke.NewInProcessExec(nil)
+		exec.Register("flaky", invoke.PluginFuncs{
+			Add: func(args *skel.CmdArgs) error {
+				_, err := fmt.Fprint(args.Stdout(), ipResult)
+				return err
+			},
+			Del: func(args *skel.CmdArgs) error {
+				if delFails {
+					return fmt.Errorf("cannot delete yet")
+				}
+				return nil
+			},
+		})
+		cniConfig = libcni.NewCNIConfigWithCacheDir([]string{filepath.Dir(pluginPaths["noop"])}, filepath.Join(tmpDir, "cache"), exec)
+		cniConfig.Journal = journal
+		cniConfig.RollbackOnFailure = true
+
+		debug := &noop_debug.Debug{ReportError: "plugin error: banana"}
+		Expect(debug.WriteDebug(debugFiles[1])).To(Succeed())
+		var err error
+		netConfigList, err = libcni.ConfListFromBytes([]byte(fmt.Sprintf(`{
+			"name": "journaltest",
+			"cniVersion": "0.4.0",
+			"plugins": [
+				{"type": "flaky"},
+				{"type": "noop", "debugFile": %q}
+			]
+		}`, debugFiles[1])))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+		Expect(err).To(MatchError(ContainSubstring("cannot delete yet")))
+		entries, err := cniConfig.ListJournal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Command).To(Equal("ADD"))
+
+		delFails = false
+		debug = &noop_debug.Debug{}
+		Expect(debug.WriteDebug(debugFiles[1])).To(Succeed())
+		recovered, err := cniConfig.RecoverJournal(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recovered).To(HaveLen(1))
+		Expect(readDebug(1).Command).To(Equal("DEL"))
+
+		entries, err = cniConfig.ListJournal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("rolls back an interrupted ADD", func() {
+		_, err := cniConfig.AddNetworkList(ctx, netConfigList, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		// The second plugin was running when the runtime exited
+		writeEntry(&libcni.JournalEntry{
+			Command:     "ADD",
+			Completed:   1,
+			PrevResults: []json.RawMessage{[]byte("null"), []byte(ipResult)},
+		})
+
+		recovered, err := cniConfig.RecoverJournal(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recovered).To(HaveLen(1))
+		Expect(recovered[0].Command).To(Equal("ADD"))
+
+		for i := range debugFiles {
+			debug := readDebug(i)
+			Expect(debug.Command).To(Equal("DEL"))
+			Expect(debug.CmdArgs.Netns).To(Equal("/some/netns/path"))
+		}
+		var conf0, conf1 map[string]interface{}
+		Expect(json.Unmarshal(readDebug(0).CmdArgs.StdinData, &conf0)).To(Succeed())
+		Expect(conf0).NotTo(HaveKey("prevResult"))
+		Expect(json.Unmarshal(readDebug(1).CmdArgs.StdinData, &conf1)).To(Succeed())
+		Expect(conf1).To(HaveKey("prevResult"))
+
+		cachedResult, err := cniConfig.GetNetworkListCachedResult(netConfigList, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cachedResult).To(BeNil())
+
+		entries, err := cniConfig.ListJournal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("finishes an interrupted DEL", func() {
+		// The last plugin of the list had already been deleted
+		writeEntry(&libcni.JournalEntry{
+			Command:     "DEL",
+			Completed:   1,
+			PrevResults: []json.RawMessage{[]byte(ipResult)},
+		})
+
+		recovered, err := cniConfig.RecoverJournal(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recovered).To(HaveLen(1))
+
+		Expect(readDebug(0).Command).To(Equal("DEL"))
+		Expect(readDebug(1).Command).To(BeEmpty())
+
+		entries, err := cniConfig.ListJournal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("keeps entries that could not be recovered", func() {
+		for _, debugFile := range debugFiles {
+			debug := &noop_debug.Debug{ReportError: "plugin error: banana"}
+			Expect(debug.WriteDebug(debugFile)).To(Succeed())
+		}
+		writeEntry(&libcni.JournalEntry{Command: "DEL"})
+
+		_, err := cniConfig.RecoverJournal(ctx)
+		Expect(err).To(MatchError(ContainSubstring("plugin error: banana")))
+
+		entries, err := cniConfig.ListJournal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+})
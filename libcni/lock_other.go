@@ -0,0 +1,30 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package libcni
+
+import "context"
+
+// fileLocks stands in for advisory file locks on platforms without flock(),
+// where locks only exclude other users in the same process
+var fileLocks = &keyedMutex{}
+
+// lockFile takes an exclusive lock named by path and returns a function that
+// releases it. It gives up and returns ctx.Err() if ctx is done before the
+// lock is taken.
+func lockFile(ctx context.Context, path string) (func(), error) {
+	return fileLocks.lock(ctx, path)
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package libcni
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+)
+
+// The lock is polled for, waiting twice as long after each failed attempt
+// up to lockPollMax, so that waiting can be given up when a context is done
+const (
+	lockPollMin = 5 * time.Millisecond
+	lockPollMax = 200 * time.Millisecond
+)
+
+// lockFile takes an exclusive advisory lock on the file at path, creating it
+// if needed, and returns a function that removes the file and releases the
+// lock. It gives up and returns ctx.Err() if ctx is done before the lock is
+// taken.
+func lockFile(ctx context.Context, path string) (func(), error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if err := flock(ctx, f); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		// The previous holder removes the file before releasing its lock,
+		// so the file we locked may no longer be the one at path. If so,
+		// try again with the new file.
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if pi, err := os.Stat(path); err == nil && os.SameFile(fi, pi) {
+			return func() {
+				os.Remove(path)
+				f.Close()
+			}, nil
+		} else if err != nil && !os.IsNotExist(err) {
+			f.Close()
+			return nil, err
+		}
+		f.Close()
+	}
+}
+
+// flock polls for an exclusive lock on f until it gets it or ctx is done
+func flock(ctx context.Context, f *os.File) error {
+	wait := lockPollMin
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return nil
+		} else if err == syscall.EINTR {
+			continue
+		} else if err != syscall.EWOULDBLOCK {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if wait *= 2; wait > lockPollMax {
+			wait = lockPollMax
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics collects statistics about the plugin invocations made by
+// libcni, and exposes them in the Prometheus text exposition format.
+//
+// A Collector is attached to a CNIConfig as its observer:
+//
+//	collector := metrics.NewCollector(nil)
+//	cniConfig.Observer = collector
+//	http.Handle("/metrics", collector)
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histogram
+// buckets used when none are given to NewCollector
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// ContentType is the content type of the Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type invocationKey struct {
+	command string
+	network string
+	plugin  string
+}
+
+type invocationStats struct {
+	count   uint64
+	errors  map[string]uint64
+	buckets []uint64
+	sum     float64
+}
+
+// Collector counts plugin invocations and their errors, and records their
+// latencies, per command, network name and plugin type. It implements
+// libcni.InvocationObserver, http.Handler and io.WriterTo, and is safe for
+// concurrent use.
+type Collector struct {
+	mu          sync.Mutex
+	buckets     []float64
+	invocations map[invocationKey]*invocationStats
+}
+
+// Collector implements the InvocationObserver interface
+var _ libcni.InvocationObserver = &Collector{}
+
+// NewCollector returns a Collector with the given latency histogram bucket
+// upper bounds, in seconds, or DefaultBuckets if buckets is empty
+func NewCollector(buckets []float64) *Collector {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Collector{
+		buckets:     sorted,
+		invocations: make(map[invocationKey]*invocationStats),
+	}
+}
+
+func (c *Collector) BeforeInvocation(ctx context.Context, inv *libcni.PluginInvocation) {}
+
+func (c *Collector) AfterInvocation(ctx context.Context, inv *libcni.PluginInvocation, duration time.Duration, result types.Result, err error) {
+	key := invocationKey{command: inv.Command, network: inv.NetworkName, plugin: inv.PluginType}
+	seconds := duration.Seconds()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats, ok := c.invocations[key]
+	if !ok {
+		stats = &invocationStats{
+			errors:  make(map[string]uint64),
+			buckets: make([]uint64, len(c.buckets)),
+		}
+		c.invocations[key] = stats
+	}
+	stats.count++
+	stats.sum += seconds
+	for i, bound := range c.buckets {
+		if seconds <= bound {
+			stats.buckets[i]++
+		}
+	}
+	if err != nil {
+		stats.errors[errorCode(err)]++
+	}
+}
+
+// errorCode returns the CNI error code of err, looking through wrapping
+// errors, or "none" if err is not a CNI error
+func errorCode(err error) string {
+	for err != nil {
+		if e, ok := err.(*types.Error); ok {
+			return strconv.FormatUint(uint64(e.Code), 10)
+		}
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = wrapper.Unwrap()
+	}
+	return "none"
+}
+
+// WriteTo writes the collected metrics to w in the Prometheus text format
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	keys := make([]invocationKey, 0, len(c.invocations))
+	for key := range c.invocations {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.command != b.command {
+			return a.command < b.command
+		}
+		if a.network != b.network {
+			return a.network < b.network
+		}
+		return a.plugin < b.plugin
+	})
+	var text strings.Builder
+	c.writeMetrics(&text, keys)
+	c.mu.Unlock()
+
+	n, err := io.WriteString(w, text.String())
+	return int64(n), err
+}
+
+func (c *Collector) writeMetrics(w *strings.Builder, keys []invocationKey) {
+	fmt.Fprintln(w, "# HELP cni_plugin_invocations_total Number of plugin invocations.")
+	fmt.Fprintln(w, "# TYPE cni_plugin_invocations_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "cni_plugin_invocations_total{%s} %d\n", key.labels(), c.invocations[key].count)
+	}
+
+	fmt.Fprintln(w, "# HELP cni_plugin_invocation_errors_total Number of failed plugin invocations, by CNI error code.")
+	fmt.Fprintln(w, "# TYPE cni_plugin_invocation_errors_total counter")
+	for _, key := range keys {
+		stats := c.invocations[key]
+		codes := make([]string, 0, len(stats.errors))
+		for code := range stats.errors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "cni_plugin_invocation_errors_total{%s,code=%s} %d\n", key.labels(), quote(code), stats.errors[code])
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP cni_plugin_invocation_duration_seconds Duration of plugin invocations.")
+	fmt.Fprintln(w, "# TYPE cni_plugin_invocation_duration_seconds histogram")
+	for _, key := range keys {
+		stats := c.invocations[key]
+		labels := key.labels()
+		for i, bound := range c.buckets {
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(w, "cni_plugin_invocation_duration_seconds_bucket{%s,le=%s} %d\n", labels, quote(le), stats.buckets[i])
+		}
+		fmt.Fprintf(w, "cni_plugin_invocation_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, stats.count)
+		fmt.Fprintf(w, "cni_plugin_invocation_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(stats.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "cni_plugin_invocation_duration_seconds_count{%s} %d\n", labels, stats.count)
+	}
+}
+
+func (k invocationKey) labels() string {
+	return fmt.Sprintf("command=%s,network=%s,plugin=%s", quote(k.command), quote(k.network), quote(k.plugin))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quote formats a label value as the Prometheus text format requires
+func quote(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+// ServeHTTP serves the collected metrics in the Prometheus text format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = c.WriteTo(w)
+}
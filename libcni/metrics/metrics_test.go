@@ -0,0 +1,116 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/libcni/metrics"
+	"github.com/containernetworking/cni/pkg/types"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Collector", func() {
+	var collector *metrics.Collector
+
+	invoke := func(command, network, plugin string, duration time.Duration, err error) {
+		inv := &libcni.PluginInvocation{Command: command, NetworkName: network, PluginType: plugin}
+		collector.BeforeInvocation(context.TODO(), inv)
+		collector.AfterInvocation(context.TODO(), inv, duration, nil, err)
+	}
+
+	BeforeEach(func() {
+		collector = metrics.NewCollector([]float64{1, 0.1})
+	})
+
+	It("writes nothing but metadata before any invocation", func() {
+		buf := &bytes.Buffer{}
+		_, err := collector.WriteTo(buf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buf.String()).To(Equal(`# HELP cni_plugin_invocations_total Number of plugin invocations.
+# TYPE cni_plugin_invocations_total counter
+# HELP cni_plugin_invocation_errors_total Number of failed plugin invocations, by CNI error code.
+# TYPE cni_plugin_invocation_errors_total counter
+# HELP cni_plugin_invocation_duration_seconds Duration of plugin invocations.
+# TYPE cni_plugin_invocation_duration_seconds histogram
+`))
+	})
+
+	It("counts invocations, errors and latencies", func() {
+		invoke("ADD", "net1", "bridge", 50*time.Millisecond, nil)
+		invoke("ADD", "net1", "bridge", 500*time.Millisecond, &types.Error{Code: types.ErrTryAgainLater})
+		invoke("ADD", "net1", "bridge", 2*time.Second, &libcni.RetryError{Attempts: 3, Err: &types.Error{Code: types.ErrTryAgainLater}})
+		invoke("DEL", "net1", "portmap", 10*time.Millisecond, errors.New("banana"))
+		invoke("VERSION", "", "bridge", 10*time.Millisecond, nil)
+
+		buf := &bytes.Buffer{}
+		n, err := collector.WriteTo(buf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(BeEquivalentTo(buf.Len()))
+		Expect(buf.String()).To(Equal(`# HELP cni_plugin_invocations_total Number of plugin invocations.
+# TYPE cni_plugin_invocations_total counter
+cni_plugin_invocations_total{command="ADD",network="net1",plugin="bridge"} 3
+cni_plugin_invocations_total{command="DEL",network="net1",plugin="portmap"} 1
+cni_plugin_invocations_total{command="VERSION",network="",plugin="bridge"} 1
+# HELP cni_plugin_invocation_errors_total Number of failed plugin invocations, by CNI error code.
+# TYPE cni_plugin_invocation_errors_total counter
+cni_plugin_invocation_errors_total{command="ADD",network="net1",plugin="bridge",code="11"} 2
+cni_plugin_invocation_errors_total{command="DEL",network="net1",plugin="portmap",code="none"} 1
+# HELP cni_plugin_invocation_duration_seconds Duration of plugin invocations.
+# TYPE cni_plugin_invocation_duration_seconds histogram
+cni_plugin_invocation_duration_seconds_bucket{command="ADD",network="net1",plugin="bridge",le="0.1"} 1
+cni_plugin_invocation_duration_seconds_bucket{command="ADD",network="net1",plugin="bridge",le="1"} 2
+cni_plugin_invocation_duration_seconds_bucket{command="ADD",network="net1",plugin="bridge",le="+Inf"} 3
+cni_plugin_invocation_duration_seconds_sum{command="ADD",network="net1",plugin="bridge"} 2.55
+cni_plugin_invocation_duration_seconds_count{command="ADD",network="net1",plugin="bridge"} 3
+cni_plugin_invocation_duration_seconds_bucket{command="DEL",network="net1",plugin="portmap",le="0.1"} 1
+cni_plugin_invocation_duration_seconds_bucket{command="DEL",network="net1",plugin="portmap",le="1"} 1
+cni_plugin_invocation_duration_seconds_bucket{command="DEL",network="net1",plugin="portmap",le="+Inf"} 1
+cni_plugin_invocation_duration_seconds_sum{command="DEL",network="net1",plugin="portmap"} 0.01
+cni_plugin_invocation_duration_seconds_count{command="DEL",network="net1",plugin="portmap"} 1
+cni_plugin_invocation_duration_seconds_bucket{command="VERSION",network="",plugin="bridge",le="0.1"} 1
+cni_plugin_invocation_duration_seconds_bucket{command="VERSION",network="",plugin="bridge",le="1"} 1
+cni_plugin_invocation_duration_seconds_bucket{command="VERSION",network="",plugin="bridge",le="+Inf"} 1
+cni_plugin_invocation_duration_seconds_sum{command="VERSION",network="",plugin="bridge"} 0.01
+cni_plugin_invocation_duration_seconds_count{command="VERSION",network="",plugin="bridge"} 1
+`))
+	})
+
+	It("escapes label values", func() {
+		invoke("ADD", "a \"quoted\"\\net\nname", "bridge", time.Millisecond, nil)
+
+		buf := &bytes.Buffer{}
+		_, err := collector.WriteTo(buf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buf.String()).To(ContainSubstring(`cni_plugin_invocations_total{command="ADD",network="a \"quoted\"\\net\nname",plugin="bridge"} 1`))
+	})
+
+	It("serves the metrics over HTTP", func() {
+		invoke("CHECK", "net1", "bridge", time.Millisecond, nil)
+
+		recorder := httptest.NewRecorder()
+		collector.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		Expect(recorder.Code).To(Equal(200))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal(metrics.ContentType))
+		Expect(recorder.Body.String()).To(ContainSubstring(`cni_plugin_invocations_total{command="CHECK",network="net1",plugin="bridge"} 1`))
+	})
+})
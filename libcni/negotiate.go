@@ -0,0 +1,202 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// VersionRejection explains why a CNI version was not chosen for a network
+// list
+type VersionRejection struct {
+	Version string
+	Reasons []string
+}
+
+// VersionNegotiation is the outcome of negotiating the CNI version of a
+// network list
+type VersionNegotiation struct {
+	// Version is the highest version acceptable to the list that all of its
+	// plugins support
+	Version string
+	// Rejected holds the acceptable versions higher than Version, highest
+	// first, and why they were rejected
+	Rejected []VersionRejection
+}
+
+// VersionNegotiationError is returned when none of the versions acceptable
+// to a network list is supported by all of its plugins
+type VersionNegotiationError struct {
+	Network  string
+	Rejected []VersionRejection
+}
+
+func (e *VersionNegotiationError) Error() string {
+	rejected := make([]string, 0, len(e.Rejected))
+	for _, r := range e.Rejected {
+		rejected = append(rejected, fmt.Sprintf("%s: %s", r.Version, strings.Join(r.Reasons, ", ")))
+	}
+	return fmt.Sprintf("no CNI version acceptable to network %q is supported by all of its plugins: %s", e.Network, strings.Join(rejected, "; "))
+}
+
+// NegotiateVersion finds the highest CNI version that is acceptable to the
+// network list and supported by all of its plugins. The versions acceptable
+// to a list are those of its "cniVersions" key if it has one, and otherwise
+// the versions known to this library up to its "cniVersion". Versions that
+// would give results which cannot be converted to the list's "cniVersion"
+// are rejected.
+func (c *CNIConfig) NegotiateVersion(ctx context.Context, list *NetworkConfigList) (*VersionNegotiation, error) {
+	candidates, err := acceptableVersions(list)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ask each type of plugin once
+	pluginTypes := []string{}
+	infos := map[string]version.PluginInfo{}
+	for _, net := range list.Plugins {
+		pluginType := net.Network.Type
+		if _, ok := infos[pluginType]; ok {
+			continue
+		}
+		pluginPath, err := c.findInPath(pluginType)
+		if err != nil {
+			return nil, err
+		}
+		vi, err := c.getVersionInfo(ctx, pluginType, pluginPath)
+		if err != nil {
+			return nil, err
+		}
+		pluginTypes = append(pluginTypes, pluginType)
+		infos[pluginType] = vi
+	}
+
+	negotiation := &VersionNegotiation{}
+	reconciler := &version.Reconciler{}
+	for _, candidate := range candidates {
+		reasons := []string{}
+		for _, pluginType := range pluginTypes {
+			if verErr := reconciler.Check(candidate, infos[pluginType]); verErr != nil {
+				reasons = append(reasons, fmt.Sprintf("plugin %s: %s", pluginType, verErr.Details()))
+			}
+		}
+		if list.CNIVersion != "" && candidate != list.CNIVersion {
+			if err := checkResultConversion(candidate, list.CNIVersion); err != nil {
+				reasons = append(reasons, fmt.Sprintf("results cannot be converted to %q: %v", list.CNIVersion, err))
+			}
+		}
+
+		if len(reasons) == 0 {
+			negotiation.Version = candidate
+			return negotiation, nil
+		}
+		negotiation.Rejected = append(negotiation.Rejected, VersionRejection{Version: candidate, Reasons: reasons})
+	}
+
+	return nil, &VersionNegotiationError{Network: list.Name, Rejected: negotiation.Rejected}
+}
+
+// acceptableVersions returns the versions acceptable to a list, highest first
+func acceptableVersions(list *NetworkConfigList) ([]string, error) {
+	var versions []string
+	if len(list.CNIVersions) > 0 {
+		for _, v := range list.CNIVersions {
+			if _, _, _, err := version.ParseVersion(v); err != nil {
+				return nil, fmt.Errorf("invalid cniVersions entry: %v", err)
+			}
+		}
+		versions = append(versions, list.CNIVersions...)
+	} else {
+		highest := list.CNIVersion
+		if highest == "" {
+			highest = "0.1.0"
+		}
+		for _, v := range version.All.SupportedVersions() {
+			gtet, err := version.GreaterThanOrEqualTo(highest, v)
+			if err != nil {
+				return nil, err
+			}
+			if gtet {
+				versions = append(versions, v)
+			}
+		}
+	}
+
+	// The versions were all parsed already
+	sort.SliceStable(versions, func(i, j int) bool {
+		gtet, _ := version.GreaterThanOrEqualTo(versions[j], versions[i])
+		return !gtet
+	})
+	return versions, nil
+}
+
+// checkResultConversion checks that results of version from can be
+// converted to version to. The sample result has an IPv4 address in the
+// formats of all versions, since results without one cannot be converted
+// to 0.2.0 and earlier.
+func checkResultConversion(from, to string) error {
+	sample := fmt.Sprintf(`{
+		"cniVersion": %q,
+		"ip4": {"ip": "10.0.0.1/24"},
+		"ips": [{"version": "4", "address": "10.0.0.1/24"}]
+	}`, from)
+	result, err := version.NewResult(from, []byte(sample))
+	if err != nil {
+		return err
+	}
+	_, err = result.GetAsVersion(to)
+	return err
+}
+
+// negotiatedList returns the list with the version negotiated for it, if
+// version negotiation is enabled
+func (c *CNIConfig) negotiatedList(ctx context.Context, list *NetworkConfigList) (*NetworkConfigList, error) {
+	if !c.NegotiateVersions {
+		return list, nil
+	}
+	negotiation, err := c.NegotiateVersion(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+	if negotiation.Version == list.CNIVersion {
+		return list, nil
+	}
+
+	rawList := map[string]interface{}{}
+	if err := json.Unmarshal(list.Bytes, &rawList); err != nil {
+		return nil, fmt.Errorf("error parsing configuration list: %s", err)
+	}
+	rawList["cniVersion"] = negotiation.Version
+	if plugins, ok := rawList["plugins"].([]interface{}); ok {
+		for _, plugin := range plugins {
+			if conf, ok := plugin.(map[string]interface{}); ok {
+				if _, ok := conf["cniVersion"]; ok {
+					conf["cniVersion"] = negotiation.Version
+				}
+			}
+		}
+	}
+	newBytes, err := json.Marshal(rawList)
+	if err != nil {
+		return nil, err
+	}
+	return ConfListFromBytes(newBytes)
+}
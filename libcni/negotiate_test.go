@@ -0,0 +1,190 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// versionedExec fakes plugins that support the given versions, recording
+// the cniVersion of the configuration each plugin is run with
+type versionedExec struct {
+	version.PluginDecoder
+
+	supported map[string][]string
+	received  []string
+	// noIPs makes the plugins return results without IP addresses
+	noIPs bool
+}
+
+func (e *versionedExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	for _, env := range environ {
+		if env == "CNI_COMMAND=VERSION" {
+			return json.Marshal(map[string]interface{}{
+				"cniVersion":        "0.4.0",
+				"supportedVersions": e.supported[filepath.Base(pluginPath)],
+			})
+		}
+	}
+
+	conf := struct {
+		CNIVersion string `json:"cniVersion"`
+	}{}
+	if err := json.Unmarshal(stdinData, &conf); err != nil {
+		return nil, err
+	}
+	e.received = append(e.received, conf.CNIVersion)
+	if e.noIPs {
+		return []byte(fmt.Sprintf(`{"cniVersion": %q}`, conf.CNIVersion)), nil
+	}
+	return []byte(fmt.Sprintf(`{"cniVersion": %q, "ips": [{"version": "4", "address": "10.1.2.3/24"}]}`, conf.CNIVersion)), nil
+}
+
+func (e *versionedExec) FindInPath(plugin string, paths []string) (string, error) {
+	return filepath.Join("/fake", plugin), nil
+}
+
+var _ = Describe("Negotiating versions", func() {
+	var (
+		tmpDir        string
+		exec          *versionedExec
+		cniConfig     *libcni.CNIConfig
+		runtimeConfig *libcni.RuntimeConf
+		ctx           context.Context
+	)
+
+	confList := func(versions string) *libcni.NetworkConfigList {
+		list, err := libcni.ConfListFromBytes([]byte(fmt.Sprintf(`{
+			"name": "negotiatetest",
+			%s,
+			"plugins": [{"type": "recent"}, {"type": "old"}]
+		}`, versions)))
+		Expect(err).NotTo(HaveOccurred())
+		return list
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cni_negotiate")
+		Expect(err).NotTo(HaveOccurred())
+
+		exec = &versionedExec{supported: map[string][]string{
+			"recent": {"0.3.0", "0.3.1", "0.4.0"},
+			"old":    {"0.2.0", "0.3.0", "0.3.1"},
+		}}
+		cniConfig = libcni.NewCNIConfigWithCacheDir([]string{"/fake"}, tmpDir, exec)
+		runtimeConfig = &libcni.RuntimeConf{
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns/path",
+			IfName:      "eth0",
+		}
+		ctx = context.TODO()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("picks the highest version every plugin supports", func() {
+		negotiation, err := cniConfig.NegotiateVersion(ctx, confList(`"cniVersion": "0.4.0"`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(negotiation).To(Equal(&libcni.VersionNegotiation{
+			Version: "0.3.1",
+			Rejected: []libcni.VersionRejection{{
+				Version: "0.4.0",
+				Reasons: []string{`plugin old: config is "0.4.0", plugin supports ["0.2.0" "0.3.0" "0.3.1"]`},
+			}},
+		}))
+	})
+
+	It("only picks versions listed in cniVersions", func() {
+		list := confList(`"cniVersion": "0.4.0", "cniVersions": ["0.3.0", "0.4.0"]`)
+		Expect(list.CNIVersions).To(Equal([]string{"0.3.0", "0.4.0"}))
+
+		negotiation, err := cniConfig.NegotiateVersion(ctx, list)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(negotiation.Version).To(Equal("0.3.0"))
+		Expect(negotiation.Rejected).To(HaveLen(1))
+	})
+
+	It("fails when no version is supported by every plugin", func() {
+		exec.supported["old"] = []string{"0.2.0"}
+
+		_, err := cniConfig.NegotiateVersion(ctx, confList(`"cniVersion": "0.4.0"`))
+		Expect(err).To(BeAssignableToTypeOf(&libcni.VersionNegotiationError{}))
+		rejected := err.(*libcni.VersionNegotiationError).Rejected
+		Expect(rejected).To(HaveLen(5))
+		Expect(rejected[3].Version).To(Equal("0.2.0"))
+		Expect(rejected[3].Reasons).To(ConsistOf(
+			`plugin recent: config is "0.2.0", plugin supports ["0.3.0" "0.3.1" "0.4.0"]`,
+			HavePrefix(`results cannot be converted to "0.4.0": `),
+		))
+	})
+
+	It("runs plugins with the negotiated version when enabled", func() {
+		cniConfig.NegotiateVersions = true
+		list := confList(`"cniVersion": "0.4.0"`)
+
+		result, err := cniConfig.AddNetworkList(ctx, list, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Version()).To(Equal("0.4.0"))
+
+		_, err = cniConfig.ValidateNetworkList(ctx, list)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cniConfig.DelNetworkList(ctx, list, runtimeConfig)).To(Succeed())
+		Expect(exec.received).To(Equal([]string{"0.3.1", "0.3.1", "0.3.1", "0.3.1"}))
+
+		By("refusing CHECK for versions that do not support it")
+		err = cniConfig.CheckNetworkList(ctx, list, runtimeConfig)
+		Expect(err).To(MatchError(`configuration version "0.3.1" does not support the CHECK command`))
+	})
+
+	It("converts results to the version of the list", func() {
+		cniConfig.NegotiateVersions = true
+		list := confList(`"cniVersion": "0.2.0", "cniVersions": ["0.2.0", "0.3.1"]`)
+
+		result, err := cniConfig.AddNetworkList(ctx, list, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Version()).To(Equal("0.2.0"))
+		Expect(exec.received).To(Equal([]string{"0.3.1", "0.3.1"}))
+	})
+
+	It("rolls back the list when its result cannot be converted", func() {
+		cniConfig.NegotiateVersions = true
+		exec.noIPs = true
+		list := confList(`"cniVersion": "0.2.0", "cniVersions": ["0.2.0", "0.3.1"]`)
+
+		_, err := cniConfig.AddNetworkList(ctx, list, runtimeConfig)
+		Expect(err).To(BeAssignableToTypeOf(&libcni.RollbackError{}))
+		Expect(err).To(MatchError(`failed to convert network "negotiatetest" result to version "0.2.0": cannot convert: no valid IP addresses`))
+		// ADD and then DEL on both plugins
+		Expect(exec.received).To(HaveLen(4))
+
+		attachments, err := cniConfig.ListCachedAttachments("negotiatetest", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attachments).To(BeEmpty())
+	})
+})
@@ -0,0 +1,103 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// PluginInvocation describes one invocation of a plugin by libcni
+type PluginInvocation struct {
+	// Command is ADD, CHECK, DEL, GC, STATUS or VERSION
+	Command string
+	// NetworkName is the name of the network the plugin is invoked for.
+	// It is empty for VERSION.
+	NetworkName string
+	PluginType  string
+	PluginPath  string
+	// StdinData is the network configuration sent to the plugin, after
+	// runtime configuration and the previous result were injected
+	StdinData []byte
+	// Environ is the environment the plugin is run with
+	Environ []string
+}
+
+// InvocationObserver is notified of every plugin invocation made by a
+// CNIConfig. If a plugin is retried, each attempt is a separate invocation.
+// The callbacks are made synchronously and must be safe for concurrent use.
+type InvocationObserver interface {
+	// BeforeInvocation is called just before the plugin is executed
+	BeforeInvocation(ctx context.Context, inv *PluginInvocation)
+	// AfterInvocation is called when the plugin has finished. The result is
+	// nil for commands that do not return one.
+	AfterInvocation(ctx context.Context, inv *PluginInvocation, duration time.Duration, result types.Result, err error)
+}
+
+// MultiObserver returns an InvocationObserver that notifies each of the
+// given observers in turn, so that several can be set on a CNIConfig
+func MultiObserver(observers ...InvocationObserver) InvocationObserver {
+	return multiObserver(append([]InvocationObserver{}, observers...))
+}
+
+type multiObserver []InvocationObserver
+
+func (m multiObserver) BeforeInvocation(ctx context.Context, inv *PluginInvocation) {
+	for _, o := range m {
+		o.BeforeInvocation(ctx, inv)
+	}
+}
+
+func (m multiObserver) AfterInvocation(ctx context.Context, inv *PluginInvocation, duration time.Duration, result types.Result, err error) {
+	for _, o := range m {
+		o.AfterInvocation(ctx, inv, duration, result, err)
+	}
+}
+
+// observedExec fills in and reports the invocation it executes
+type observedExec struct {
+	invoke.Exec
+
+	observer InvocationObserver
+	inv      *PluginInvocation
+	started  time.Time
+}
+
+func (e *observedExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	e.inv.StdinData = stdinData
+	e.inv.Environ = environ
+	e.observer.BeforeInvocation(ctx, e.inv)
+	e.started = time.Now()
+	return e.Exec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+}
+
+// observe calls fn with an Exec that reports the invocation to the observer
+func (c *CNIConfig) observe(ctx context.Context, inv *PluginInvocation, fn func(invoke.Exec) (types.Result, error)) (types.Result, error) {
+	c.ensureExec()
+	if c.Observer == nil {
+		return fn(c.exec)
+	}
+
+	exec := &observedExec{Exec: c.exec, observer: c.Observer, inv: inv}
+	result, err := fn(exec)
+	// Nothing is reported if the plugin was never executed
+	if !exec.started.IsZero() {
+		c.Observer.AfterInvocation(ctx, inv, time.Since(exec.started), result, err)
+	}
+	return result, err
+}
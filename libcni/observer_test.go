@@ -0,0 +1,170 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/types"
+	noop_debug "github.com/containernetworking/cni/plugins/test/noop/debug"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type observedInvocation struct {
+	libcni.PluginInvocation
+	Result types.Result
+	Err    error
+}
+
+type recordingObserver struct {
+	mu     sync.Mutex
+	before []libcni.PluginInvocation
+	after  []observedInvocation
+}
+
+func (o *recordingObserver) BeforeInvocation(ctx context.Context, inv *libcni.PluginInvocation) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.before = append(o.before, *inv)
+}
+
+func (o *recordingObserver) AfterInvocation(ctx context.Context, inv *libcni.PluginInvocation, duration time.Duration, result types.Result, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	Expect(duration).To(BeNumerically(">", 0))
+	o.after = append(o.after, observedInvocation{*inv, result, err})
+}
+
+var _ = Describe("Invocation observers", func() {
+	var (
+		tmpDir        string
+		debugFilePath string
+		netConfigList *libcni.NetworkConfigList
+		runtimeConfig *libcni.RuntimeConf
+		observer      *recordingObserver
+		cniConfig     *libcni.CNIConfig
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cni_observer")
+		Expect(err).NotTo(HaveOccurred())
+
+		debugFilePath = filepath.Join(tmpDir, "debug")
+		debug := &noop_debug.Debug{
+			ReportResult: `{"cniVersion": "0.4.0", "ips": [{"version": "4", "address": "10.1.2.3/24"}]}`,
+		}
+		Expect(debug.WriteDebug(debugFilePath)).To(Succeed())
+
+		netConfigList, err = libcni.ConfListFromBytes([]byte(fmt.Sprintf(`{
+			"name": "observertest",
+			"cniVersion": "0.4.0",
+			"plugins": [
+				{"type": "noop", "debugFile": %q},
+				{"type": "noop", "debugFile": %q}
+			]
+		}`, debugFilePath, debugFilePath)))
+		Expect(err).NotTo(HaveOccurred())
+
+		runtimeConfig = &libcni.RuntimeConf{
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns/path",
+			IfName:      "eth0",
+		}
+
+		observer = &recordingObserver{}
+		cniConfig = libcni.NewCNIConfigWithCacheDir([]string{filepath.Dir(pluginPaths["noop"])}, tmpDir, nil)
+		cniConfig.Observer = observer
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("reports each plugin invocation of a list", func() {
+		_, err := cniConfig.AddNetworkList(context.TODO(), netConfigList, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(observer.before).To(HaveLen(2))
+		Expect(observer.after).To(HaveLen(2))
+		for i, inv := range observer.after {
+			Expect(inv.PluginInvocation).To(Equal(observer.before[i]))
+			Expect(inv.Command).To(Equal("ADD"))
+			Expect(inv.NetworkName).To(Equal("observertest"))
+			Expect(inv.PluginType).To(Equal("noop"))
+			Expect(inv.PluginPath).To(Equal(pluginPaths["noop"]))
+			Expect(inv.Environ).To(ContainElement("CNI_COMMAND=ADD"))
+			Expect(inv.Environ).To(ContainElement("CNI_IFNAME=eth0"))
+			Expect(inv.Result).NotTo(BeNil())
+			Expect(inv.Err).NotTo(HaveOccurred())
+		}
+
+		// The second plugin is sent the result of the first
+		stdin := map[string]interface{}{}
+		Expect(json.Unmarshal(observer.after[1].StdinData, &stdin)).To(Succeed())
+		Expect(stdin).To(HaveKey("prevResult"))
+	})
+
+	It("reports plugin errors", func() {
+		debug := &noop_debug.Debug{ReportError: "plugin error: banana"}
+		Expect(debug.WriteDebug(debugFilePath)).To(Succeed())
+
+		err := cniConfig.DelNetworkList(context.TODO(), netConfigList, runtimeConfig)
+		Expect(err).To(HaveOccurred())
+
+		// DEL goes on to the other plugin of the list
+		Expect(observer.after).To(HaveLen(2))
+		for _, inv := range observer.after {
+			Expect(inv.Command).To(Equal("DEL"))
+			Expect(inv.Result).To(BeNil())
+		}
+		delErr, ok := err.(*libcni.DelError)
+		Expect(ok).To(BeTrue())
+		Expect(delErr.Errors[0].(*libcni.ListPluginError).Err).To(Equal(observer.after[0].Err))
+	})
+
+	It("reports invocations to each of several observers", func() {
+		other := &recordingObserver{}
+		cniConfig.Observer = libcni.MultiObserver(observer, other)
+
+		_, err := cniConfig.AddNetworkList(context.TODO(), netConfigList, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(observer.before).To(HaveLen(2))
+		Expect(observer.after).To(HaveLen(2))
+		Expect(other.before).To(Equal(observer.before))
+		Expect(other.after).To(Equal(observer.after))
+	})
+
+	It("reports VERSION invocations", func() {
+		_, err := cniConfig.GetVersionInfo(context.TODO(), "noop")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(observer.after).To(HaveLen(1))
+		Expect(observer.after[0].Command).To(Equal("VERSION"))
+		Expect(observer.after[0].NetworkName).To(BeEmpty())
+		Expect(observer.after[0].Environ).To(ContainElement("CNI_COMMAND=VERSION"))
+	})
+})
@@ -0,0 +1,144 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// NetworkListsError is returned by AddNetworkLists and DelNetworkLists when
+// some of the networks failed. Errors maps the names of those networks to
+// their error.
+type NetworkListsError struct {
+	Errors map[string]error
+}
+
+func (e *NetworkListsError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := make([]error, 0, len(names))
+	for _, name := range names {
+		errs = append(errs, fmt.Errorf("network %q: %v", name, e.Errors[name]))
+	}
+	return fmt.Sprintf("%v", errs)
+}
+
+// runParallel calls fn with 0 to n-1, running at most workers calls at a
+// time, or all of them at once if workers is not positive, and waits for
+// them to return
+func runParallel(n, workers int, fn func(i int)) {
+	if workers <= 0 || workers > n {
+		workers = n
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// checkUniqueNames checks that the lists can be told apart by their names
+func checkUniqueNames(lists []*NetworkConfigList) error {
+	names := map[string]bool{}
+	for _, list := range lists {
+		if names[list.Name] {
+			return fmt.Errorf("duplicate network name %q", list.Name)
+		}
+		names[list.Name] = true
+	}
+	return nil
+}
+
+// AddNetworkLists executes AddNetworkList for each of the lists with the
+// same RuntimeConf, concurrently, with at most workers lists being added at
+// a time, or all of them if workers is not positive. The lists must have
+// different names.
+//
+// The results are returned by network name. If some networks fail, the
+// results of the others are returned along with a *NetworkListsError; the
+// networks that were added are not torn down.
+func (c *CNIConfig) AddNetworkLists(ctx context.Context, lists []*NetworkConfigList, rt *RuntimeConf, workers int) (map[string]types.Result, error) {
+	if err := checkUniqueNames(lists); err != nil {
+		return nil, err
+	}
+
+	results := make([]types.Result, len(lists))
+	errs := make([]error, len(lists))
+	runParallel(len(lists), workers, func(i int) {
+		results[i], errs[i] = c.AddNetworkList(ctx, lists[i], rt)
+	})
+
+	resultMap := make(map[string]types.Result, len(lists))
+	listsErr := &NetworkListsError{Errors: map[string]error{}}
+	for i, list := range lists {
+		if errs[i] != nil {
+			listsErr.Errors[list.Name] = errs[i]
+		} else {
+			resultMap[list.Name] = results[i]
+		}
+	}
+	if len(listsErr.Errors) > 0 {
+		return resultMap, listsErr
+	}
+	return resultMap, nil
+}
+
+// DelNetworkLists executes DelNetworkList for each of the lists with the
+// same RuntimeConf, concurrently, with at most workers lists being deleted
+// at a time, or all of them if workers is not positive. Every list is
+// deleted even if some fail, and the failures are returned as a
+// *NetworkListsError.
+func (c *CNIConfig) DelNetworkLists(ctx context.Context, lists []*NetworkConfigList, rt *RuntimeConf, workers int) error {
+	if err := checkUniqueNames(lists); err != nil {
+		return err
+	}
+
+	errs := make([]error, len(lists))
+	runParallel(len(lists), workers, func(i int) {
+		errs[i] = c.DelNetworkList(ctx, lists[i], rt)
+	})
+
+	listsErr := &NetworkListsError{Errors: map[string]error{}}
+	for i, list := range lists {
+		if errs[i] != nil {
+			listsErr.Errors[list.Name] = errs[i]
+		}
+	}
+	if len(listsErr.Errors) > 0 {
+		return listsErr
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/types/current"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func parallelNetworks(names ...string) []*libcni.NetworkConfigList {
+	var lists []*libcni.NetworkConfigList
+	for _, name := range names {
+		list, err := libcni.ConfListFromBytes([]byte(fmt.Sprintf(`{
+			"name": %q,
+			"cniVersion": "0.4.0",
+			"plugins": [{"type": "paralleltest"}]
+		}`, name)))
+		Expect(err).NotTo(HaveOccurred())
+		lists = append(lists, list)
+	}
+	return lists
+}
+
+var _ = Describe("Adding and deleting several network lists", func() {
+	var (
+		tmpDir        string
+		plugin        *recordingPlugin
+		cniConfig     *libcni.CNIConfig
+		runtimeConfig *libcni.RuntimeConf
+		ctx           context.Context
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cni_parallel")
+		Expect(err).NotTo(HaveOccurred())
+
+		plugin = &recordingPlugin{delay: 20 * time.Millisecond}
+		exec := invoke.NewInProcessExec(nil)
+		exec.Register("paralleltest", plugin.funcs())
+		cniConfig = libcni.NewCNIConfigWithCacheDir([]string{"/fake"}, tmpDir, exec)
+
+		runtimeConfig = &libcni.RuntimeConf{
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns/path",
+			IfName:      "some-eth0",
+		}
+		ctx = context.TODO()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("adds the networks concurrently and returns their results by name", func() {
+		lists := parallelNetworks("net1", "net2", "net3", "net4")
+		results, err := cniConfig.AddNetworkLists(ctx, lists, runtimeConfig, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(4))
+		for _, name := range []string{"net1", "net2", "net3", "net4"} {
+			result, err := current.GetResult(results[name])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.DNS.Nameservers).To(Equal([]string{name}))
+		}
+		Expect(plugin.getMaxRunning()).To(BeNumerically(">", 1))
+
+		Expect(cniConfig.DelNetworkLists(ctx, lists, runtimeConfig, 0)).To(Succeed())
+		Expect(plugin.getCalls()).To(HaveLen(8))
+		attachments, err := cniConfig.ListCachedAttachments("", "some-container-id")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attachments).To(BeEmpty())
+	})
+
+	It("runs at most the given number of workers", func() {
+		lists := parallelNetworks("net1", "net2", "net3", "net4", "net5")
+		_, err := cniConfig.AddNetworkLists(ctx, lists, runtimeConfig, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cniConfig.DelNetworkLists(ctx, lists, runtimeConfig, 2)).To(Succeed())
+		Expect(plugin.getCalls()).To(HaveLen(10))
+		Expect(plugin.getMaxRunning()).To(BeNumerically("<=", 2))
+	})
+
+	It("returns the results of the networks that were added with the errors", func() {
+		lists := parallelNetworks("net1", "bad1", "net2", "bad2")
+		results, err := cniConfig.AddNetworkLists(ctx, lists, runtimeConfig, 0)
+		Expect(err).To(MatchError(`[network "bad1": ADD failed on bad1 network "bad2": ADD failed on bad2]`))
+		Expect(err).To(BeAssignableToTypeOf(&libcni.NetworkListsError{}))
+		Expect(err.(*libcni.NetworkListsError).Errors).To(HaveLen(2))
+		Expect(results).To(HaveLen(2))
+		Expect(results).To(HaveKey("net1"))
+		Expect(results).To(HaveKey("net2"))
+	})
+
+	It("deletes every network even if some fail", func() {
+		lists := parallelNetworks("bad1", "net1", "net2")
+		err := cniConfig.DelNetworkLists(ctx, lists, runtimeConfig, 1)
+		Expect(err).To(MatchError(`[network "bad1": [plugin 0 (type "paralleltest"): DEL failed on bad1]]`))
+		Expect(plugin.getCalls()).To(ConsistOf("DEL bad1 some-eth0", "DEL net1 some-eth0", "DEL net2 some-eth0"))
+	})
+
+	It("refuses lists with the same name", func() {
+		lists := parallelNetworks("net1", "net2", "net1")
+		_, err := cniConfig.AddNetworkLists(ctx, lists, runtimeConfig, 0)
+		Expect(err).To(MatchError(`duplicate network name "net1"`))
+		Expect(cniConfig.DelNetworkLists(ctx, lists, runtimeConfig, 0)).To(MatchError(`duplicate network name "net1"`))
+		Expect(plugin.getCalls()).To(BeEmpty())
+	})
+})
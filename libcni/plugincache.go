@@ -0,0 +1,142 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// PluginCache remembers where plugins were found in the path and which
+// versions they support, so that a CNIConfig does not search the path and
+// run VERSION for every operation. An entry is dropped as soon as the
+// modification time, size or inode of the plugin binary changes. A plugin
+// installed earlier in the path than a cached one is only picked up once
+// the cached one changes or the cache is cleared.
+//
+// The zero value is an empty cache. It is safe for concurrent use.
+type PluginCache struct {
+	mu       sync.Mutex
+	paths    map[string]cachedPlugin
+	versions map[string]cachedPlugin
+}
+
+type cachedPlugin struct {
+	path        string
+	stamp       fileStamp
+	versionInfo version.PluginInfo
+}
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	modTime int64
+	size    int64
+	inode   uint64
+}
+
+func statPlugin(path string) (fileStamp, bool) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, false
+	}
+	return fileStamp{
+		modTime: fi.ModTime().UnixNano(),
+		size:    fi.Size(),
+		inode:   fileInode(fi),
+	}, true
+}
+
+// Clear empties the cache
+func (pc *PluginCache) Clear() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.paths = nil
+	pc.versions = nil
+}
+
+// lookup returns the entry for key if the plugin binary it refers to has
+// not changed since it was cached
+func (pc *PluginCache) lookup(entries map[string]cachedPlugin, key string) (cachedPlugin, bool) {
+	pc.mu.Lock()
+	entry, ok := entries[key]
+	pc.mu.Unlock()
+	if !ok {
+		return cachedPlugin{}, false
+	}
+	if stamp, ok := statPlugin(entry.path); !ok || stamp != entry.stamp {
+		return cachedPlugin{}, false
+	}
+	return entry, true
+}
+
+// findInPath finds a plugin with exec, or returns where it was last found.
+// It is safe to call on a nil cache.
+func (pc *PluginCache) findInPath(exec invoke.Exec, plugin string, paths []string) (string, error) {
+	if pc == nil {
+		return exec.FindInPath(plugin, paths)
+	}
+
+	// The same plugin may be found in different places with different paths
+	key := plugin + "\x00" + strings.Join(paths, string(os.PathListSeparator))
+	if entry, ok := pc.lookup(pc.paths, key); ok {
+		return entry.path, nil
+	}
+
+	pluginPath, err := exec.FindInPath(plugin, paths)
+	if err != nil {
+		return "", err
+	}
+	// Plugins that are not files, like those of fake Execs, are not cached
+	if stamp, ok := statPlugin(pluginPath); ok {
+		pc.mu.Lock()
+		if pc.paths == nil {
+			pc.paths = map[string]cachedPlugin{}
+		}
+		pc.paths[key] = cachedPlugin{path: pluginPath, stamp: stamp}
+		pc.mu.Unlock()
+	}
+	return pluginPath, nil
+}
+
+// getVersionInfo returns the cached version information of a plugin, or
+// calls getVersionInfo and caches it. It is safe to call on a nil cache.
+func (pc *PluginCache) getVersionInfo(pluginPath string, getVersionInfo func() (version.PluginInfo, error)) (version.PluginInfo, error) {
+	if pc == nil {
+		return getVersionInfo()
+	}
+
+	if entry, ok := pc.lookup(pc.versions, pluginPath); ok {
+		return entry.versionInfo, nil
+	}
+
+	// If the plugin changes while it runs, the stamp taken beforehand no
+	// longer matches and the next lookup runs it again
+	stamp, cacheable := statPlugin(pluginPath)
+	vi, err := getVersionInfo()
+	if err != nil || !cacheable {
+		return vi, err
+	}
+	pc.mu.Lock()
+	if pc.versions == nil {
+		pc.versions = map[string]cachedPlugin{}
+	}
+	pc.versions[pluginPath] = cachedPlugin{path: pluginPath, stamp: stamp, versionInfo: vi}
+	pc.mu.Unlock()
+	return vi, nil
+}
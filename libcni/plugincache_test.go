@@ -0,0 +1,139 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// countingExec counts the lookups and executions of the Exec it wraps
+type countingExec struct {
+	invoke.Exec
+
+	lookups int32
+	execs   int32
+}
+
+func (e *countingExec) FindInPath(plugin string, paths []string) (string, error) {
+	atomic.AddInt32(&e.lookups, 1)
+	return e.Exec.FindInPath(plugin, paths)
+}
+
+func (e *countingExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	atomic.AddInt32(&e.execs, 1)
+	return e.Exec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+}
+
+var _ = Describe("Caching plugins", func() {
+	var (
+		tmpDir        string
+		pluginPath    string
+		exec          *countingExec
+		cniConfig     *libcni.CNIConfig
+		netConfigList *libcni.NetworkConfigList
+		ctx           context.Context
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cni_plugincache")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Use a copy of the plugin that can be replaced
+		pluginBytes, err := ioutil.ReadFile(pluginPaths["noop"])
+		Expect(err).NotTo(HaveOccurred())
+		pluginPath = filepath.Join(tmpDir, "noop")
+		Expect(ioutil.WriteFile(pluginPath, pluginBytes, 0755)).To(Succeed())
+
+		exec = &countingExec{Exec: &invoke.DefaultExec{
+			RawExec:       &invoke.RawExec{Stderr: GinkgoWriter},
+			PluginDecoder: version.PluginDecoder{},
+		}}
+		cniConfig = libcni.NewCNIConfigWithCacheDir([]string{tmpDir}, tmpDir, exec)
+		cniConfig.PluginCache = &libcni.PluginCache{}
+
+		netConfigList, err = libcni.ConfListFromBytes([]byte(`{
+			"name": "plugincachetest",
+			"cniVersion": "0.4.0",
+			"plugins": [{"type": "noop"}, {"type": "noop"}]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		ctx = context.TODO()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("finds plugins and runs VERSION once", func() {
+		for i := 0; i < 3; i++ {
+			_, err := cniConfig.ValidateNetworkList(ctx, netConfigList)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(exec.lookups).To(Equal(int32(1)))
+		Expect(exec.execs).To(Equal(int32(1)))
+
+		versionInfo, err := cniConfig.GetVersionInfo(ctx, "noop")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versionInfo.SupportedVersions()).To(ContainElement("0.4.0"))
+		Expect(exec.execs).To(Equal(int32(1)))
+	})
+
+	It("forgets plugins whose binary changed", func() {
+		_, err := cniConfig.ValidateNetworkList(ctx, netConfigList)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Replace the binary the way installers do, by renaming a new file
+		// over it, which gives it a new inode
+		pluginBytes, err := ioutil.ReadFile(pluginPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(pluginPath+".new", pluginBytes, 0755)).To(Succeed())
+		fi, err := os.Stat(pluginPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chtimes(pluginPath+".new", fi.ModTime(), fi.ModTime())).To(Succeed())
+		Expect(os.Rename(pluginPath+".new", pluginPath)).To(Succeed())
+
+		_, err = cniConfig.ValidateNetworkList(ctx, netConfigList)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exec.lookups).To(Equal(int32(2)))
+		Expect(exec.execs).To(Equal(int32(2)))
+
+		By("removing the plugin")
+		Expect(os.Remove(pluginPath)).To(Succeed())
+		_, err = cniConfig.ValidateNetworkList(ctx, netConfigList)
+		Expect(err).To(MatchError(ContainSubstring(`failed to find plugin "noop"`)))
+	})
+
+	It("does not cache without a plugin cache", func() {
+		cniConfig.PluginCache = nil
+		for i := 0; i < 2; i++ {
+			_, err := cniConfig.ValidateNetworkList(ctx, netConfigList)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(exec.lookups).To(Equal(int32(4)))
+		Expect(exec.execs).To(Equal(int32(4)))
+	})
+})
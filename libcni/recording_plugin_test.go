@@ -0,0 +1,106 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// recordingPlugin is an in-process plugin that records the commands it is
+// run with and how many of its invocations run at the same time. ADD gives
+// the interface an address and the network name as DNS nameserver.
+// Commands fail on networks whose name starts with "bad", and when the
+// command is named by a FAIL argument, such as FAIL=DEL.
+type recordingPlugin struct {
+	// delay is how long each invocation takes
+	delay time.Duration
+
+	mu         sync.Mutex
+	calls      []string
+	running    int
+	maxRunning int
+}
+
+func (p *recordingPlugin) record(command string, args *skel.CmdArgs) (*types.NetConf, error) {
+	conf := &types.NetConf{}
+	if err := json.Unmarshal(args.StdinData, conf); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.calls = append(p.calls, fmt.Sprintf("%s %s %s", command, conf.Name, args.IfName))
+	p.running++
+	if p.running > p.maxRunning {
+		p.maxRunning = p.running
+	}
+	p.mu.Unlock()
+
+	time.Sleep(p.delay)
+
+	p.mu.Lock()
+	p.running--
+	p.mu.Unlock()
+
+	if strings.HasPrefix(conf.Name, "bad") || strings.Contains(args.Args, "FAIL="+command) {
+		return nil, fmt.Errorf("%s failed on %s", command, conf.Name)
+	}
+	return conf, nil
+}
+
+func (p *recordingPlugin) funcs() invoke.PluginFuncs {
+	return invoke.PluginFuncs{
+		Add: func(args *skel.CmdArgs) error {
+			conf, err := p.record("ADD", args)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(args.Stdout(), `{
+				"cniVersion": %q,
+				"interfaces": [{"name": %q, "sandbox": %q}],
+				"ips": [{"interface": 0, "address": "10.0.%s.2/24"}],
+				"dns": {"nameservers": [%q]}
+			}`, conf.CNIVersion, args.IfName, args.Netns, args.IfName[len(args.IfName)-1:], conf.Name)
+			return err
+		},
+		Check: func(args *skel.CmdArgs) error {
+			_, err := p.record("CHECK", args)
+			return err
+		},
+		Del: func(args *skel.CmdArgs) error {
+			_, err := p.record("DEL", args)
+			return err
+		},
+	}
+}
+
+func (p *recordingPlugin) getCalls() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.calls...)
+}
+
+func (p *recordingPlugin) getMaxRunning() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.maxRunning
+}
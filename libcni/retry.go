@@ -0,0 +1,124 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// RetryPolicy controls how plugins that fail with types.ErrTryAgainLater are
+// retried. Attempts are spaced by an exponentially growing backoff with
+// random jitter, and retrying stops early if the next attempt could not
+// start before the context deadline.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a plugin is run, including
+	// the first attempt. Values less than 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. Zero means no cap.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the backoff grows after each
+	// attempt. Values less than 1 default to 2.
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, of each backoff that is
+	// randomized, so that competing callers do not retry in lockstep
+	Jitter float64
+}
+
+// RetryError is returned when a RetryPolicy is set and a plugin that failed
+// with types.ErrTryAgainLater could not be retried successfully. Err is the
+// error of the last attempt.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%v (after %d attempts)", e.Err, e.Attempts)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// isTryAgainLater returns true if err is a CNI error asking the runtime to
+// retry the operation later
+func isTryAgainLater(err error) bool {
+	e, ok := err.(*types.Error)
+	return ok && e.Code == types.ErrTryAgainLater
+}
+
+// backoff returns the delay to wait after the given number of attempts
+func (p *RetryPolicy) backoff(attempts int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempts; i++ {
+		backoff *= multiplier
+		if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	jitter := p.Jitter
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+	return time.Duration(backoff * (1 - jitter*rand.Float64()))
+}
+
+// withRetry calls fn until it succeeds, fails with an error other than
+// types.ErrTryAgainLater, or the policy gives up
+func (p *RetryPolicy) withRetry(ctx context.Context, fn func() error) error {
+	err := fn()
+	if p == nil || p.MaxAttempts < 2 {
+		return err
+	}
+
+	attempts := 1
+	for ; err != nil && isTryAgainLater(err) && attempts < p.MaxAttempts; attempts++ {
+		delay := p.backoff(attempts)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			break
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &RetryError{Attempts: attempts, Err: err}
+		case <-timer.C:
+		}
+		err = fn()
+	}
+
+	if err != nil && (attempts > 1 || isTryAgainLater(err)) {
+		return &RetryError{Attempts: attempts, Err: err}
+	}
+	return err
+}
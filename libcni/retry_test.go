@@ -0,0 +1,143 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// busyExec fails the first failures calls with err, then succeeds
+type busyExec struct {
+	version.PluginDecoder
+
+	failures int
+	err      error
+	calls    int
+}
+
+func (e *busyExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	e.calls++
+	if e.calls <= e.failures {
+		return nil, e.err
+	}
+	return []byte(`{"cniVersion": "0.4.0", "ips": [{"version": "4", "address": "10.1.2.3/24"}]}`), nil
+}
+
+func (e *busyExec) FindInPath(plugin string, paths []string) (string, error) {
+	return filepath.Join("/fake", plugin), nil
+}
+
+var _ = Describe("Retrying plugins", func() {
+	var (
+		tmpDir        string
+		exec          *busyExec
+		cniConfig     *libcni.CNIConfig
+		netConfig     *libcni.NetworkConfig
+		runtimeConfig *libcni.RuntimeConf
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cni_retry")
+		Expect(err).NotTo(HaveOccurred())
+
+		exec = &busyExec{
+			failures: 2,
+			err:      &types.Error{Code: types.ErrTryAgainLater, Msg: "address pool is locked"},
+		}
+		cniConfig = libcni.NewCNIConfigWithCacheDir([]string{"/fake"}, tmpDir, exec)
+		cniConfig.Retry = &libcni.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Jitter:         0.5,
+		}
+
+		netConfig, err = libcni.ConfFromBytes([]byte(`{"name": "retrytest", "type": "busy", "cniVersion": "0.4.0"}`))
+		Expect(err).NotTo(HaveOccurred())
+		runtimeConfig = &libcni.RuntimeConf{
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns/path",
+			IfName:      "eth0",
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("retries plugins that ask to be retried later", func() {
+		_, err := cniConfig.AddNetwork(context.TODO(), netConfig, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exec.calls).To(Equal(3))
+	})
+
+	It("returns the attempt count when the plugin keeps failing", func() {
+		exec.failures = 10
+
+		_, err := cniConfig.AddNetwork(context.TODO(), netConfig, runtimeConfig)
+		Expect(err).To(HaveOccurred())
+		Expect(exec.calls).To(Equal(3))
+
+		retryErr, ok := err.(*libcni.RetryError)
+		Expect(ok).To(BeTrue())
+		Expect(retryErr.Attempts).To(Equal(3))
+		Expect(retryErr.Unwrap()).To(Equal(exec.err))
+		Expect(err.Error()).To(Equal("address pool is locked (after 3 attempts)"))
+	})
+
+	It("does not retry other errors", func() {
+		exec.err = &types.Error{Code: types.ErrInternal, Msg: "banana"}
+
+		_, err := cniConfig.AddNetwork(context.TODO(), netConfig, runtimeConfig)
+		Expect(err).To(Equal(exec.err))
+		Expect(exec.calls).To(Equal(1))
+
+		exec.calls = 0
+		exec.err = errors.New("banana")
+		err = cniConfig.DelNetwork(context.TODO(), netConfig, runtimeConfig)
+		Expect(err).To(Equal(exec.err))
+		Expect(exec.calls).To(Equal(1))
+	})
+
+	It("does not retry without a retry policy", func() {
+		cniConfig.Retry = nil
+
+		_, err := cniConfig.AddNetwork(context.TODO(), netConfig, runtimeConfig)
+		Expect(err).To(Equal(exec.err))
+		Expect(exec.calls).To(Equal(1))
+	})
+
+	It("stops retrying when the next attempt would miss the context deadline", func() {
+		cniConfig.Retry.InitialBackoff = time.Hour
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		_, err := cniConfig.AddNetwork(ctx, netConfig, runtimeConfig)
+		Expect(err).To(Equal(&libcni.RetryError{Attempts: 1, Err: exec.err}))
+		Expect(exec.calls).To(Equal(1))
+	})
+})
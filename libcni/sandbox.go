@@ -0,0 +1,284 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/types/current"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// SandboxNetwork is a network that a sandbox, such as a pod, is attached to
+type SandboxNetwork struct {
+	Network *NetworkConfigList
+	// IfName is the name of the sandbox's interface on the network. If
+	// empty, it is "eth0" for the first network and "net1", "net2" and so
+	// on for the others.
+	IfName string
+	// Args and CapabilityArgs are added to those of the RuntimeConf when
+	// the network is set up or torn down, and take precedence over them
+	Args           [][2]string
+	CapabilityArgs map[string]interface{}
+}
+
+// SandboxNetworks sets up and tears down the attachments of one sandbox to
+// a default network and any number of additional networks.
+type SandboxNetworks struct {
+	// Parallel makes the networks be set up, checked and torn down
+	// concurrently instead of one after the other.
+	Parallel bool
+	// MaxParallel limits how many networks are handled at a time when
+	// Parallel is set; there is no limit if it is not positive.
+	MaxParallel int
+
+	cni      CNI
+	networks []*SandboxNetwork
+}
+
+// SandboxAttachment is the result of setting up one of the networks of a
+// sandbox
+type SandboxAttachment struct {
+	NetworkName string
+	IfName      string
+	Result      types.Result
+}
+
+// SandboxResult holds the results of setting up the networks of a sandbox,
+// in the order of the networks
+type SandboxResult struct {
+	Attachments []*SandboxAttachment
+}
+
+// NewSandboxNetworks returns a SandboxNetworks that attaches sandboxes to
+// the given networks through cni. The first network is the default one.
+// Networks without an interface name get "eth0" if they are first, and
+// "net" followed by their position otherwise; it is an error for two
+// networks to use the same interface name.
+func NewSandboxNetworks(cni CNI, networks ...*SandboxNetwork) (*SandboxNetworks, error) {
+	s := &SandboxNetworks{cni: cni}
+	ifNames := map[string]bool{}
+	for i, n := range networks {
+		if n.Network == nil {
+			return nil, fmt.Errorf("sandbox network %d has no configuration", i)
+		}
+		sn := *n
+		if sn.IfName == "" {
+			sn.IfName = "eth0"
+			if i > 0 {
+				sn.IfName = fmt.Sprintf("net%d", i)
+			}
+		}
+		if ifNames[sn.IfName] {
+			return nil, fmt.Errorf("duplicate interface name %q", sn.IfName)
+		}
+		ifNames[sn.IfName] = true
+		s.networks = append(s.networks, &sn)
+	}
+	return s, nil
+}
+
+// Networks returns the networks of the sandbox, with their interface names
+func (s *SandboxNetworks) Networks() []*SandboxNetwork {
+	return s.networks
+}
+
+// runtimeConf returns the RuntimeConf of the sandbox for one of its networks
+func (s *SandboxNetworks) runtimeConf(rt *RuntimeConf, n *SandboxNetwork) *RuntimeConf {
+	newRt := *rt
+	newRt.IfName = n.IfName
+	if len(n.Args) > 0 {
+		newRt.Args = append(append([][2]string{}, rt.Args...), n.Args...)
+	}
+	if len(n.CapabilityArgs) > 0 {
+		newRt.CapabilityArgs = make(map[string]interface{}, len(rt.CapabilityArgs)+len(n.CapabilityArgs))
+		for k, v := range rt.CapabilityArgs {
+			newRt.CapabilityArgs[k] = v
+		}
+		for k, v := range n.CapabilityArgs {
+			newRt.CapabilityArgs[k] = v
+		}
+	}
+	return &newRt
+}
+
+// forEach calls fn for each of the given networks, concurrently if Parallel
+// is set, with at most MaxParallel at a time, and returns the errors by
+// network. Unless Parallel is set, it stops at the first error if
+// stopOnError is set.
+func (s *SandboxNetworks) forEach(networks []*SandboxNetwork, stopOnError bool, fn func(i int, n *SandboxNetwork) error) []error {
+	errs := make([]error, len(networks))
+	if !s.Parallel {
+		for i, n := range networks {
+			errs[i] = fn(i, n)
+			if errs[i] != nil && stopOnError {
+				break
+			}
+		}
+		return errs
+	}
+
+	runParallel(len(networks), s.MaxParallel, func(i int) {
+		errs[i] = fn(i, networks[i])
+	})
+	return errs
+}
+
+// reversed returns the networks in reverse order
+func reversed(networks []*SandboxNetwork) []*SandboxNetwork {
+	r := make([]*SandboxNetwork, 0, len(networks))
+	for i := len(networks) - 1; i >= 0; i-- {
+		r = append(r, networks[i])
+	}
+	return r
+}
+
+// collectErrors returns the errors of the networks that failed, with the
+// network they are about
+func collectErrors(networks []*SandboxNetwork, errs []error) []error {
+	var collected []error
+	for i, err := range errs {
+		if err != nil {
+			collected = append(collected, fmt.Errorf("network %q interface %q: %v", networks[i].Network.Name, networks[i].IfName, err))
+		}
+	}
+	return collected
+}
+
+// Setup attaches the sandbox described by rt to all its networks; rt.IfName
+// is ignored. If any network fails, the networks that were set up, and
+// those that failed, which may be partly set up, are torn down again in
+// reverse order and a *RollbackError is returned.
+func (s *SandboxNetworks) Setup(ctx context.Context, rt *RuntimeConf) (*SandboxResult, error) {
+	results := make([]types.Result, len(s.networks))
+	errs := s.forEach(s.networks, true, func(i int, n *SandboxNetwork) error {
+		result, err := s.cni.AddNetworkList(ctx, n.Network, s.runtimeConf(rt, n))
+		if err != nil {
+			return err
+		}
+		results[i] = result
+		return nil
+	})
+
+	if addErrs := collectErrors(s.networks, errs); len(addErrs) > 0 {
+		var attempted []*SandboxNetwork
+		for i, n := range s.networks {
+			if results[i] != nil || errs[i] != nil {
+				attempted = append(attempted, n)
+			}
+		}
+		var err error = addErrs[0]
+		if len(addErrs) > 1 {
+			err = fmt.Errorf("%v", addErrs)
+		}
+		return nil, &RollbackError{Err: err, CleanupErrors: s.teardown(ctx, rt, attempted)}
+	}
+
+	sr := &SandboxResult{}
+	for i, n := range s.networks {
+		sr.Attachments = append(sr.Attachments, &SandboxAttachment{
+			NetworkName: n.Network.Name,
+			IfName:      n.IfName,
+			Result:      results[i],
+		})
+	}
+	return sr, nil
+}
+
+// Check checks the attachments of the sandbox described by rt to all its
+// networks, and returns the errors of all the networks that failed
+// together. Networks whose configuration version predates CHECK are
+// skipped.
+func (s *SandboxNetworks) Check(ctx context.Context, rt *RuntimeConf) error {
+	errs := s.forEach(s.networks, false, func(_ int, n *SandboxNetwork) error {
+		// CHECK was added in CNI spec version 0.4.0 and higher
+		if gtet, err := version.GreaterThanOrEqualTo(n.Network.CNIVersion, "0.4.0"); err != nil {
+			return err
+		} else if !gtet {
+			return nil
+		}
+		return s.cni.CheckNetworkList(ctx, n.Network, s.runtimeConf(rt, n))
+	})
+	if checkErrs := collectErrors(s.networks, errs); len(checkErrs) > 0 {
+		return fmt.Errorf("%v", checkErrs)
+	}
+	return nil
+}
+
+// Teardown detaches the sandbox described by rt from all its networks, in
+// the reverse order of Setup. Every network is torn down even if some fail,
+// and the errors are returned together.
+func (s *SandboxNetworks) Teardown(ctx context.Context, rt *RuntimeConf) error {
+	if errs := s.teardown(ctx, rt, s.networks); len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+func (s *SandboxNetworks) teardown(ctx context.Context, rt *RuntimeConf, networks []*SandboxNetwork) []error {
+	networks = reversed(networks)
+	errs := s.forEach(networks, false, func(_ int, n *SandboxNetwork) error {
+		return s.cni.DelNetworkList(ctx, n.Network, s.runtimeConf(rt, n))
+	})
+	return collectErrors(networks, errs)
+}
+
+// Merged returns the results of all the attachments as a single result:
+// their interfaces, IP addresses and routes are concatenated, and the DNS
+// settings of the first attachment that has any are used.
+func (r *SandboxResult) Merged() (*types100.Result, error) {
+	merged := &types100.Result{CNIVersion: types100.ImplementedSpecVersion}
+	for _, att := range r.Attachments {
+		result, err := toResult100(att.Result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert network %q interface %q result: %v", att.NetworkName, att.IfName, err)
+		}
+
+		offset := len(merged.Interfaces)
+		merged.Interfaces = append(merged.Interfaces, result.Interfaces...)
+		for _, ip := range result.IPs {
+			newIP := *ip
+			if ip.Interface != nil {
+				newIP.Interface = types100.Int(*ip.Interface + offset)
+			}
+			merged.IPs = append(merged.IPs, &newIP)
+		}
+		merged.Routes = append(merged.Routes, result.Routes...)
+		if isEmptyDNS(merged.DNS) {
+			merged.DNS = result.DNS
+		}
+	}
+	return merged, nil
+}
+
+func isEmptyDNS(dns types.DNS) bool {
+	return len(dns.Nameservers) == 0 && dns.Domain == "" && len(dns.Search) == 0 && len(dns.Options) == 0
+}
+
+// toResult100 converts a result of any version to a 1.0.0 result
+func toResult100(result types.Result) (*types100.Result, error) {
+	if r, err := types100.GetResult(result); err == nil {
+		return r, nil
+	}
+	// 0.1.0 and 0.2.0 results only convert up to 0.4.0
+	r, err := current.NewResultFromResult(result)
+	if err != nil {
+		return nil, err
+	}
+	return types100.GetResult(r)
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libcni_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/invoke"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func sandboxNetwork(name, cniVersion string) *libcni.SandboxNetwork {
+	list, err := libcni.ConfListFromBytes([]byte(fmt.Sprintf(`{
+		"name": %q,
+		"cniVersion": %q,
+		"plugins": [{"type": "sandboxtest"}]
+	}`, name, cniVersion)))
+	Expect(err).NotTo(HaveOccurred())
+	return &libcni.SandboxNetwork{Network: list}
+}
+
+var _ = Describe("Sandbox networks", func() {
+	var (
+		tmpDir        string
+		plugin        *recordingPlugin
+		cniConfig     *libcni.CNIConfig
+		networks      []*libcni.SandboxNetwork
+		runtimeConfig *libcni.RuntimeConf
+		ctx           context.Context
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cni_sandbox")
+		Expect(err).NotTo(HaveOccurred())
+
+		plugin = &recordingPlugin{}
+		exec := invoke.NewInProcessExec(nil)
+		exec.Register("sandboxtest", plugin.funcs())
+		cniConfig = libcni.NewCNIConfigWithCacheDir([]string{"/fake"}, tmpDir, exec)
+
+		networks = []*libcni.SandboxNetwork{
+			sandboxNetwork("default", "0.4.0"),
+			sandboxNetwork("storage", "1.0.0"),
+			sandboxNetwork("backend", "0.3.1"),
+		}
+		runtimeConfig = &libcni.RuntimeConf{
+			ContainerID: "some-pod",
+			NetNS:       "/some/netns/path",
+			IfName:      "ignored",
+		}
+		ctx = context.TODO()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("allocates interface names", func() {
+		networks[2].IfName = "backend0"
+		sn, err := libcni.NewSandboxNetworks(cniConfig, networks...)
+		Expect(err).NotTo(HaveOccurred())
+
+		var ifNames []string
+		for _, n := range sn.Networks() {
+			ifNames = append(ifNames, n.IfName)
+		}
+		Expect(ifNames).To(Equal([]string{"eth0", "net1", "backend0"}))
+		// The given networks are not modified
+		Expect(networks[0].IfName).To(BeEmpty())
+	})
+
+	It("refuses duplicate interface names", func() {
+		networks[0].IfName = "net1"
+		_, err := libcni.NewSandboxNetworks(cniConfig, networks...)
+		Expect(err).To(MatchError(`duplicate interface name "net1"`))
+	})
+
+	It("sets up the networks in order and tears them down in reverse", func() {
+		sn, err := libcni.NewSandboxNetworks(cniConfig, networks...)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := sn.Setup(ctx, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Attachments).To(HaveLen(3))
+		for i, att := range result.Attachments {
+			Expect(att.NetworkName).To(Equal(networks[i].Network.Name))
+		}
+		Expect(result.Attachments[1].IfName).To(Equal("net1"))
+
+		// CHECK is skipped for the 0.3.1 network
+		Expect(sn.Check(ctx, runtimeConfig)).To(Succeed())
+		Expect(sn.Teardown(ctx, runtimeConfig)).To(Succeed())
+
+		Expect(plugin.getCalls()).To(Equal([]string{
+			"ADD default eth0", "ADD storage net1", "ADD backend net2",
+			"CHECK default eth0", "CHECK storage net1",
+			"DEL backend net2", "DEL storage net1", "DEL default eth0",
+		}))
+		Expect(runtimeConfig.IfName).To(Equal("ignored"))
+	})
+
+	It("merges the results", func() {
+		sn, err := libcni.NewSandboxNetworks(cniConfig, networks...)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := sn.Setup(ctx, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		merged, err := result.Merged()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Marshal(merged)).To(MatchJSON(`{
+			"cniVersion": "1.0.0",
+			"interfaces": [
+				{"name": "eth0", "sandbox": "/some/netns/path"},
+				{"name": "net1", "sandbox": "/some/netns/path"},
+				{"name": "net2", "sandbox": "/some/netns/path"}
+			],
+			"ips": [
+				{"interface": 0, "address": "10.0.0.2/24"},
+				{"interface": 1, "address": "10.0.1.2/24"},
+				{"interface": 2, "address": "10.0.2.2/24"}
+			],
+			"dns": {"nameservers": ["default"]}
+		}`))
+		// The results of the attachments are not modified
+		Expect(result.Attachments[0].Result.Version()).To(Equal("0.4.0"))
+	})
+
+	It("adds the per-network arguments", func() {
+		networks[1].Args = [][2]string{{"NETWORK", "storage"}}
+		runtimeConfig.Args = [][2]string{{"POD", "some-pod"}}
+		sn, err := libcni.NewSandboxNetworks(cniConfig, networks...)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = sn.Setup(ctx, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, rt, err := cniConfig.GetNetworkListCachedConfig(networks[1].Network, &libcni.RuntimeConf{ContainerID: "some-pod", IfName: "net1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rt.Args).To(Equal([][2]string{{"POD", "some-pod"}, {"NETWORK", "storage"}}))
+		Expect(runtimeConfig.Args).To(HaveLen(1))
+	})
+
+	Context("when a network fails to be set up", func() {
+		BeforeEach(func() {
+			networks[2].Args = [][2]string{{"FAIL", "ADD"}}
+		})
+
+		It("tears down the networks that were set up and the one that failed", func() {
+			sn, err := libcni.NewSandboxNetworks(cniConfig, networks...)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = sn.Setup(ctx, runtimeConfig)
+			Expect(err).To(MatchError(`network "backend" interface "net2": ADD failed on backend`))
+			Expect(err).To(BeAssignableToTypeOf(&libcni.RollbackError{}))
+
+			Expect(plugin.getCalls()).To(Equal([]string{
+				"ADD default eth0", "ADD storage net1", "ADD backend net2",
+				"DEL backend net2", "DEL storage net1", "DEL default eth0",
+			}))
+			attachments, err := cniConfig.ListCachedAttachments("", "some-pod")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attachments).To(BeEmpty())
+		})
+
+		It("tears down the networks that were set up and the one that failed when run in parallel", func() {
+			sn, err := libcni.NewSandboxNetworks(cniConfig, networks...)
+			Expect(err).NotTo(HaveOccurred())
+			sn.Parallel = true
+
+			_, err = sn.Setup(ctx, runtimeConfig)
+			Expect(err).To(MatchError(`network "backend" interface "net2": ADD failed on backend`))
+
+			calls := plugin.getCalls()
+			Expect(calls).To(HaveLen(6))
+			Expect(calls[:3]).To(ConsistOf("ADD default eth0", "ADD storage net1", "ADD backend net2"))
+			Expect(calls[3:]).To(ConsistOf("DEL backend net2", "DEL storage net1", "DEL default eth0"))
+		})
+	})
+
+	It("sets up and tears down the networks in parallel", func() {
+		sn, err := libcni.NewSandboxNetworks(cniConfig, networks...)
+		Expect(err).NotTo(HaveOccurred())
+		sn.Parallel = true
+
+		result, err := sn.Setup(ctx, runtimeConfig)
+		Expect(err).NotTo(HaveOccurred())
+		for i, att := range result.Attachments {
+			Expect(att.NetworkName).To(Equal(networks[i].Network.Name))
+		}
+
+		Expect(sn.Teardown(ctx, runtimeConfig)).To(Succeed())
+		Expect(plugin.getCalls()).To(ConsistOf(
+			"ADD default eth0", "ADD storage net1", "ADD backend net2",
+			"DEL backend net2", "DEL storage net1", "DEL default eth0",
+		))
+	})
+
+	It("tears down all the networks even if some fail", func() {
+		networks[1].Args = [][2]string{{"FAIL", "DEL"}}
+		sn, err := libcni.NewSandboxNetworks(cniConfig, networks...)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = sn.Teardown(ctx, runtimeConfig)
+		Expect(err).To(MatchError(`[network "storage" interface "net1": [plugin 0 (type "sandboxtest"): DEL failed on storage]]`))
+		Expect(plugin.getCalls()).To(Equal([]string{
+			"DEL backend net2", "DEL storage net1", "DEL default eth0",
+		}))
+	})
+})
@@ -72,6 +72,19 @@ func DelegateDel(ctx context.Context, delegatePlugin string, netconf []byte, exe
 	return ExecPluginWithoutResult(ctx, pluginPath, netconf, delegateArgs("DEL"), realExec)
 }
 
+// DelegateGC calls the given delegate plugin with the CNI GC action and
+// JSON configuration, which lists the valid attachments under the
+// "cni.dev/valid-attachments" key
+func DelegateGC(ctx context.Context, delegatePlugin string, netconf []byte, exec Exec) error {
+	pluginPath, realExec, err := delegateCommon(delegatePlugin, exec)
+	if err != nil {
+		return err
+	}
+
+	// DelegateGC will override the original CNI_COMMAND env from process with GC
+	return ExecPluginWithoutResult(ctx, pluginPath, netconf, delegateArgs("GC"), realExec)
+}
+
 // return CNIArgs used by delegation
 func delegateArgs(action string) *DelegateArgs {
 	return &DelegateArgs{
@@ -224,4 +224,41 @@ var _ = Describe("Delegate", func() {
 			})
 		})
 	})
+
+	Describe("DelegateGC", func() {
+		BeforeEach(func() {
+			os.Setenv("CNI_COMMAND", "DEL")
+			netConf, _ = json.Marshal(map[string]interface{}{
+				"name":       "delegate-test",
+				"cniVersion": "0.4.0",
+				"cni.dev/valid-attachments": []map[string]string{
+					{"containerID": "container", "ifname": "eth7"},
+				},
+			})
+		})
+
+		It("finds and execs the named plugin with the GC command", func() {
+			err := invoke.DelegateGC(ctx, pluginName, netConf, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			pluginInvocation, err := debug.ReadDebug(debugFileName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pluginInvocation.Command).To(Equal("GC"))
+			Expect(pluginInvocation.CmdArgs.StdinData).To(MatchJSON(netConf))
+
+			// check the original env
+			Expect(os.Getenv("CNI_COMMAND")).To(Equal("DEL"))
+		})
+
+		Context("when the plugin cannot be found", func() {
+			BeforeEach(func() {
+				pluginName = "non-existent-plugin"
+			})
+
+			It("returns a useful error", func() {
+				err := invoke.DelegateGC(ctx, pluginName, netConf, nil)
+				Expect(err).To(MatchError(HavePrefix("failed to find plugin")))
+			})
+		})
+	})
 })
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/version"
@@ -129,6 +130,26 @@ func GetVersionInfo(ctx context.Context, pluginPath string, exec Exec) (version.
 	return exec.Decode(stdoutBytes)
 }
 
+// GetStatus runs the STATUS command of the plugin with the given network
+// configuration, to find out whether it is ready to service ADD requests.
+// STATUS is not about a container, so no container ID, network namespace or
+// interface name is passed to the plugin; paths are where it can find the
+// plugins it delegates to. GetStatus returns nil if the plugin is ready, or
+// the error the plugin reported, such as types.ErrPluginNotAvailable.
+// STATUS was added in CNI spec version 1.1.0, so it should only be sent to
+// plugins that support that version or later.
+func GetStatus(ctx context.Context, pluginPath string, netconf []byte, paths []string, exec Exec) error {
+	if exec == nil {
+		exec = defaultExec
+	}
+	args := &Args{
+		Command: "STATUS",
+		Path:    strings.Join(paths, string(os.PathListSeparator)),
+	}
+	_, err := exec.ExecPlugin(ctx, pluginPath, netconf, args.AsEnv())
+	return err
+}
+
 // DefaultExec is an object that implements the Exec interface which looks
 // for and executes plugins from disk.
 type DefaultExec struct {
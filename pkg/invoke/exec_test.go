@@ -21,6 +21,7 @@ import (
 
 	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/invoke/fakes"
+	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/types/current"
 	"github.com/containernetworking/cni/pkg/version"
 
@@ -176,4 +177,34 @@ var _ = Describe("Executing a plugin, unit tests", func() {
 			})
 		})
 	})
+
+	Describe("getting the plugin status", func() {
+		BeforeEach(func() {
+			rawExec.ExecPluginCall.Returns.ResultBytes = nil
+		})
+
+		It("execs the plugin with the command STATUS and no container", func() {
+			err := invoke.GetStatus(ctx, pluginPath, netconf, []string{"/some/path", "/other/path"}, pluginExec)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rawExec.ExecPluginCall.Received.PluginPath).To(Equal(pluginPath))
+			Expect(rawExec.ExecPluginCall.Received.StdinData).To(Equal(netconf))
+
+			env := rawExec.ExecPluginCall.Received.Environ
+			Expect(env).To(ContainElement("CNI_COMMAND=STATUS"))
+			Expect(env).To(ContainElement("CNI_PATH=/some/path:/other/path"))
+			Expect(env).To(ContainElement("CNI_CONTAINERID="))
+			Expect(env).To(ContainElement("CNI_NETNS="))
+			Expect(env).To(ContainElement("CNI_IFNAME="))
+		})
+
+		Context("when the plugin is not ready", func() {
+			BeforeEach(func() {
+				rawExec.ExecPluginCall.Returns.Error = types.NewError(types.ErrPluginNotAvailable, "daemon is not running", "")
+			})
+			It("returns the error", func() {
+				err := invoke.GetStatus(ctx, pluginPath, netconf, nil, pluginExec)
+				Expect(err).To(Equal(types.NewError(types.ErrPluginNotAvailable, "daemon is not running", "")))
+			})
+		})
+	})
 })
@@ -0,0 +1,152 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// PluginFuncs are the callbacks of a plugin, as passed to skel.PluginMainFuncs,
+// that can be run in-process. The callbacks must print their result to
+// CmdArgs.Stdout() rather than os.Stdout.
+type PluginFuncs struct {
+	Add         func(*skel.CmdArgs) error
+	Check       func(*skel.CmdArgs) error
+	Del         func(*skel.CmdArgs) error
+	GC          func(*skel.CmdArgs) error
+	Status      func(*skel.CmdArgs) error
+	VersionInfo version.PluginInfo
+}
+
+// InProcessExec is an Exec that runs registered plugins as Go functions
+// in the current process instead of executing a binary. Plugins get the
+// same environment, stdin and stdout they would as a binary, through
+// skel.PluginMainFuncsWithIO. Plugin types that are not registered are found
+// and executed by the wrapped Exec.
+//
+// Unlike a binary, an in-process plugin cannot be killed: it is only
+// checked that the context has not expired before it is run.
+type InProcessExec struct {
+	Exec
+
+	// Stderr receives what in-process plugins write to stderr. If nil,
+	// it is discarded.
+	Stderr io.Writer
+
+	mu      sync.RWMutex
+	plugins map[string]*PluginFuncs
+}
+
+// NewInProcessExec returns an InProcessExec with no registered plugins,
+// falling back to exec for the others. If exec is nil, they are executed
+// as usual.
+func NewInProcessExec(exec Exec) *InProcessExec {
+	if exec == nil {
+		exec = defaultExec
+	}
+	return &InProcessExec{Exec: exec, plugins: map[string]*PluginFuncs{}}
+}
+
+// Register makes plugins of the given type run in-process, replacing any
+// plugin already registered for it. If funcs.VersionInfo is nil, the
+// plugin supports all versions.
+func (e *InProcessExec) Register(plugin string, funcs PluginFuncs) {
+	if funcs.VersionInfo == nil {
+		funcs.VersionInfo = version.All
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.plugins[plugin] = &funcs
+}
+
+func (e *InProcessExec) lookup(pluginPath string) *PluginFuncs {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.plugins[filepath.Base(pluginPath)]
+}
+
+// FindInPath returns the path of a registered plugin as if it were in the
+// first of the paths, and searches the paths for the others
+func (e *InProcessExec) FindInPath(plugin string, paths []string) (string, error) {
+	if e.lookup(plugin) == nil || strings.ContainsRune(plugin, os.PathSeparator) {
+		return e.Exec.FindInPath(plugin, paths)
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("no paths provided")
+	}
+	return filepath.Join(paths[0], plugin), nil
+}
+
+func (e *InProcessExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	funcs := e.lookup(pluginPath)
+	if funcs == nil {
+		return e.Exec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// As for processes, later values take precedence
+	env := map[string]string{}
+	for _, kv := range environ {
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	getenv := func(key string) string { return env[key] }
+
+	stderr := e.Stderr
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	stdout := &bytes.Buffer{}
+	if err := runInProcess(pluginPath, funcs, getenv, stdinData, stdout, stderr); err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// runInProcess runs a registered plugin, turning a panic into an error so
+// that a faulty plugin does not bring the runtime down
+func runInProcess(pluginPath string, funcs *PluginFuncs, getenv func(string) string, stdinData []byte, stdout, stderr io.Writer) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = types.NewError(types.ErrInternal, fmt.Sprintf("plugin %s panicked: %v", pluginPath, r), "")
+		}
+	}()
+
+	if cniErr := skel.PluginMainFuncsWithIO(getenv, bytes.NewReader(stdinData), stdout, stderr, skel.CNIFuncs{
+		Add:    funcs.Add,
+		Check:  funcs.Check,
+		Del:    funcs.Del,
+		GC:     funcs.GC,
+		Status: funcs.Status,
+	}, funcs.VersionInfo, ""); cniErr != nil {
+		return cniErr
+	}
+	return nil
+}
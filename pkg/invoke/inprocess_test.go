@@ -0,0 +1,133 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+	noop_debug "github.com/containernetworking/cni/plugins/test/noop/debug"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Executing plugins in-process", func() {
+	var (
+		execer   *invoke.InProcessExec
+		received *skel.CmdArgs
+		args     *invoke.Args
+		ctx      context.Context
+	)
+
+	const (
+		netconf = `{"name": "inprocesstest", "cniVersion": "0.4.0", "type": "embedded"}`
+		result  = `{"cniVersion": "0.4.0", "ips": [{"version": "4", "address": "10.1.2.3/24"}], "dns": {}}`
+	)
+
+	BeforeEach(func() {
+		received = nil
+		execer = invoke.NewInProcessExec(nil)
+		execer.Register("embedded", invoke.PluginFuncs{
+			Add: func(cmdArgs *skel.CmdArgs) error {
+				received = cmdArgs
+				_, err := cmdArgs.Stdout().Write([]byte(result))
+				return err
+			},
+			Check: func(cmdArgs *skel.CmdArgs) error {
+				return errors.New("banana")
+			},
+			Del: func(cmdArgs *skel.CmdArgs) error {
+				panic("potato")
+			},
+			VersionInfo: version.PluginSupports("0.3.1", "0.4.0"),
+		})
+
+		args = &invoke.Args{
+			Command:     "ADD",
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns/path",
+			PluginArgs:  [][2]string{{"FOO", "BAR"}},
+			IfName:      "eth0",
+			Path:        "/some/bin",
+		}
+		ctx = context.TODO()
+	})
+
+	It("runs registered plugins with the usual arguments", func() {
+		pluginPath, err := execer.FindInPath("embedded", []string{"/some/bin"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pluginPath).To(Equal(filepath.Join("/some/bin", "embedded")))
+
+		r, err := invoke.ExecPluginWithResult(ctx, pluginPath, []byte(netconf), args, execer)
+		Expect(err).NotTo(HaveOccurred())
+		resultJSON, err := json.Marshal(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resultJSON).To(MatchJSON(result))
+
+		Expect(received.ContainerID).To(Equal("some-container-id"))
+		Expect(received.Netns).To(Equal("/some/netns/path"))
+		Expect(received.IfName).To(Equal("eth0"))
+		Expect(received.Args).To(Equal("FOO=BAR"))
+		Expect(received.Path).To(Equal("/some/bin"))
+		Expect(received.StdinData).To(MatchJSON(netconf))
+	})
+
+	It("returns plugin errors as CNI errors", func() {
+		args.Command = "CHECK"
+		err := invoke.ExecPluginWithoutResult(ctx, "/some/bin/embedded", []byte(netconf), args, execer)
+		Expect(err).To(Equal(&types.Error{Code: types.ErrInternal, Msg: "banana"}))
+
+		args.Command = "DEL"
+		err = invoke.ExecPluginWithoutResult(ctx, "/some/bin/embedded", []byte(netconf), args, execer)
+		Expect(err).To(Equal(&types.Error{Code: types.ErrInternal, Msg: "plugin /some/bin/embedded panicked: potato"}))
+	})
+
+	It("reports the version of registered plugins", func() {
+		versionInfo, err := invoke.GetVersionInfo(ctx, "/some/bin/embedded", execer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versionInfo.SupportedVersions()).To(ConsistOf("0.3.1", "0.4.0"))
+	})
+
+	It("executes plugins that are not registered", func() {
+		debugFile, err := ioutil.TempFile("", "cni_debug")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(debugFile.Close()).To(Succeed())
+		defer os.Remove(debugFile.Name())
+
+		debug := &noop_debug.Debug{ReportResult: result}
+		Expect(debug.WriteDebug(debugFile.Name())).To(Succeed())
+		args.PluginArgs = [][2]string{{"DEBUG", debugFile.Name()}}
+
+		pluginPath, err := execer.FindInPath(filepath.Base(pathToPlugin), []string{filepath.Dir(pathToPlugin)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pluginPath).To(Equal(pathToPlugin))
+
+		_, err = invoke.ExecPluginWithResult(ctx, pluginPath, []byte(netconf), args, execer)
+		Expect(err).NotTo(HaveOccurred())
+
+		debug, err = noop_debug.ReadDebug(debugFile.Name())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(debug.Command).To(Equal("ADD"))
+	})
+})
@@ -0,0 +1,60 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifest loads the DigestAllowlist of an invoke.VerifyingExec from
+// a signed manifest. It is separate from package invoke because it needs
+// golang.org/x/crypto, while invoke, which every plugin imports, needs only
+// the standard library.
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"golang.org/x/crypto/ed25519"
+)
+
+// InvalidSignatureError is returned by LoadSignedManifest when the manifest
+// was not signed with the expected key
+type InvalidSignatureError struct{}
+
+func (e *InvalidSignatureError) Error() string {
+	return "plugin manifest signature is invalid"
+}
+
+// SignedManifest is a DigestAllowlist signed with an Ed25519 key. Manifest
+// holds the JSON encoding of the allowlist, and Signature its signature.
+type SignedManifest struct {
+	Manifest  []byte `json:"manifest"`
+	Signature []byte `json:"signature"`
+}
+
+// LoadSignedManifest parses a JSON-encoded SignedManifest and returns its
+// allowlist if it was signed with the private key of publicKey
+func LoadSignedManifest(data []byte, publicKey ed25519.PublicKey) (invoke.DigestAllowlist, error) {
+	signed := &SignedManifest{}
+	if err := json.Unmarshal(data, signed); err != nil {
+		return nil, fmt.Errorf("failed to parse plugin manifest: %v", err)
+	}
+	if len(publicKey) != ed25519.PublicKeySize || !ed25519.Verify(publicKey, signed.Manifest, signed.Signature) {
+		return nil, &InvalidSignatureError{}
+	}
+
+	allowlist := invoke.DigestAllowlist{}
+	if err := json.Unmarshal(signed.Manifest, &allowlist); err != nil {
+		return nil, fmt.Errorf("failed to parse plugin manifest: %v", err)
+	}
+	return allowlist, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest_test
+
+import (
+	"crypto/rand"
+	"encoding/json"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/invoke/manifest"
+	"golang.org/x/crypto/ed25519"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signed manifests", func() {
+	const digest = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	var (
+		publicKey ed25519.PublicKey
+		signed    *manifest.SignedManifest
+	)
+
+	BeforeEach(func() {
+		var privateKey ed25519.PrivateKey
+		var err error
+		publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		data, err := json.Marshal(invoke.DigestAllowlist{"noop": {digest}})
+		Expect(err).NotTo(HaveOccurred())
+		signed = &manifest.SignedManifest{
+			Manifest:  data,
+			Signature: ed25519.Sign(privateKey, data),
+		}
+	})
+
+	It("returns the allowlist of the manifest", func() {
+		data, err := json.Marshal(signed)
+		Expect(err).NotTo(HaveOccurred())
+		allowlist, err := manifest.LoadSignedManifest(data, publicKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allowlist).To(Equal(invoke.DigestAllowlist{"noop": {digest}}))
+		Expect(allowlist.Verify("noop", "/some/path/noop", digest)).To(Succeed())
+	})
+
+	It("rejects tampered manifests", func() {
+		signed.Manifest = []byte(`{"noop": ["0000"]}`)
+		data, err := json.Marshal(signed)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = manifest.LoadSignedManifest(data, publicKey)
+		Expect(err).To(Equal(&manifest.InvalidSignatureError{}))
+	})
+
+	It("rejects manifests signed with another key", func() {
+		otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		data, err := json.Marshal(signed)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = manifest.LoadSignedManifest(data, otherKey)
+		Expect(err).To(Equal(&manifest.InvalidSignatureError{}))
+	})
+})
@@ -20,37 +20,212 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"syscall"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/types"
 )
 
+const (
+	defaultStderrTailSize = 4096
+	defaultMaxStdoutSize  = 1 << 20
+)
+
 type RawExec struct {
 	Stderr io.Writer
+
+	// GracePeriod is how long a plugin is given to exit after it is sent
+	// SIGTERM because its context was cancelled or expired, before it is
+	// sent SIGKILL. If zero, the plugin is sent SIGKILL straight away.
+	// Either signal goes to the plugin's whole process group, so that
+	// helper processes it forked are cleaned up too.
+	GracePeriod time.Duration
+
+	// StderrTailSize is how many bytes from the end of a plugin's stderr
+	// are kept to be attached to the error if the plugin fails. If zero,
+	// 4 KiB are kept. The output is still written to Stderr in full.
+	StderrTailSize int
+
+	// MaxStdoutSize is the largest output, in bytes, accepted from a
+	// plugin. If zero, the limit is 1 MiB; if negative, there is no limit.
+	MaxStdoutSize int
+}
+
+// KilledError is returned by RawExec when it killed a plugin because the
+// context of the plugin was cancelled or expired. Err is the context's error.
+type KilledError struct {
+	Plugin string
+	Err    error
+	// Stderr holds the end of the plugin's stderr output
+	Stderr string
+}
+
+func (e *KilledError) Error() string {
+	return fmt.Sprintf("netplugin %s was killed: %v%s", e.Plugin, e.Err, formatStderr(e.Stderr))
+}
+
+func (e *KilledError) Unwrap() error {
+	return e.Err
+}
+
+func formatStderr(stderr string) string {
+	if stderr == "" {
+		return ""
+	}
+	return fmt.Sprintf("; stderr: %q", stderr)
+}
+
+// OutputTooLargeError is returned by RawExec when a plugin writes more than
+// MaxStdoutSize bytes to stdout
+type OutputTooLargeError struct {
+	Plugin string
+	Limit  int
+}
+
+func (e *OutputTooLargeError) Error() string {
+	return fmt.Sprintf("netplugin %s output exceeds the limit of %d bytes", e.Plugin, e.Limit)
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.max:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.buf)
+}
+
+// limitedBuffer keeps the first max bytes written to it, and discards the
+// rest without failing. A negative max means no limit. onExceed, if set, is
+// called the first time the limit is exceeded.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int
+	exceeded bool
+	onExceed func()
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if l.max >= 0 && l.buf.Len()+len(p) > l.max {
+		if !l.exceeded && l.onExceed != nil {
+			l.onExceed()
+		}
+		l.exceeded = true
+		return len(p), nil
+	}
+	return l.buf.Write(p)
+}
+
+func (l *limitedBuffer) Bytes() []byte {
+	return l.buf.Bytes()
 }
 
 func (e *RawExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
-	stdout := &bytes.Buffer{}
-	c := exec.CommandContext(ctx, pluginPath)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	maxStdout := e.MaxStdoutSize
+	if maxStdout == 0 {
+		maxStdout = defaultMaxStdoutSize
+	}
+	stderrTailSize := e.StderrTailSize
+	if stderrTailSize <= 0 {
+		stderrTailSize = defaultStderrTailSize
+	}
+
+	stdout := &limitedBuffer{max: maxStdout}
+	stderr := &tailBuffer{max: stderrTailSize}
+	c := exec.Command(pluginPath)
 	c.Env = environ
 	c.Stdin = bytes.NewBuffer(stdinData)
 	c.Stdout = stdout
-	c.Stderr = e.Stderr
-	if err := c.Run(); err != nil {
-		return nil, pluginErr(err, stdout.Bytes())
+	c.Stderr = stderr
+	if e.Stderr != nil {
+		c.Stderr = io.MultiWriter(e.Stderr, stderr)
 	}
+	setProcessGroup(c)
+	// There is no point in letting the plugin run once its output is
+	// known to be rejected
+	stdout.onExceed = func() {
+		_ = killProcessGroup(c.Process)
+	}
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if stdout.exceeded {
+			return nil, &OutputTooLargeError{Plugin: pluginPath, Limit: maxStdout}
+		}
+		if err != nil {
+			return nil, pluginErr(err, stdout.Bytes(), stderr.String())
+		}
+		return stdout.Bytes(), nil
+	case <-ctx.Done():
+		e.terminate(c.Process, done)
+		return nil, &KilledError{Plugin: pluginPath, Err: ctx.Err(), Stderr: stderr.String()}
+	}
+}
 
-	return stdout.Bytes(), nil
+// terminate stops the process group of a plugin, giving it GracePeriod to
+// exit after SIGTERM, and waits for the plugin to be reaped
+func (e *RawExec) terminate(p *os.Process, done <-chan error) {
+	if e.GracePeriod > 0 {
+		_ = terminateProcessGroup(p)
+		timer := time.NewTimer(e.GracePeriod)
+		select {
+		case <-done:
+			timer.Stop()
+			// Helpers may outlive the plugin, so the group is
+			// still killed below
+			_ = killProcessGroup(p)
+			return
+		case <-timer.C:
+		}
+	}
+	_ = killProcessGroup(p)
+	<-done
 }
 
-func pluginErr(err error, output []byte) error {
-	if _, ok := err.(*exec.ExitError); ok {
+func pluginErr(err error, output []byte, stderr string) error {
+	if exitErr, ok := err.(*exec.ExitError); ok {
 		emsg := types.Error{}
 		if len(output) == 0 {
 			emsg.Msg = "netplugin failed with no error message"
 		} else if perr := json.Unmarshal(output, &emsg); perr != nil {
 			emsg.Msg = fmt.Sprintf("netplugin failed but error parsing its diagnostic message %q: %v", string(output), perr)
+		} else {
+			return &emsg
+		}
+
+		// The plugin did not explain the failure, so record how it
+		// ended and what it printed to stderr
+		emsg.Details = exitErr.String()
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			emsg.Details = fmt.Sprintf("exit code %d", status.ExitStatus())
+			if status.Signaled() {
+				emsg.Details = fmt.Sprintf("killed by signal: %v", status.Signal())
+			}
 		}
+		emsg.Details += formatStderr(stderr)
 		return &emsg
 	}
 
@@ -17,10 +17,16 @@ package invoke_test
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/types"
 
 	noop_debug "github.com/containernetworking/cni/plugins/test/noop/debug"
 
@@ -116,6 +122,154 @@ var _ = Describe("RawExec", func() {
 		})
 	})
 
+	Context("when the plugin output is too large", func() {
+		It("returns an OutputTooLargeError", func() {
+			execer.MaxStdoutSize = 10
+			_, err := execer.ExecPlugin(ctx, pathToPlugin, stdin, environ)
+			Expect(err).To(Equal(&invoke.OutputTooLargeError{Plugin: pathToPlugin, Limit: 10}))
+		})
+
+		It("kills the plugin once the limit is exceeded", func() {
+			if runtime.GOOS == "windows" {
+				Skip("test plugins are shell scripts")
+			}
+			tmpDir, err := ioutil.TempDir("", "cni_raw_exec")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(tmpDir)
+			pluginPath := filepath.Join(tmpDir, "chatty-plugin")
+			Expect(ioutil.WriteFile(pluginPath, []byte("#!/bin/sh\nhead -c 100 /dev/zero\nsleep 60\n"), 0700)).To(Succeed())
+
+			execer.MaxStdoutSize = 10
+			start := time.Now()
+			_, err = execer.ExecPlugin(ctx, pluginPath, stdin, environ)
+			Expect(err).To(Equal(&invoke.OutputTooLargeError{Plugin: pluginPath, Limit: 10}))
+			Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+		})
+	})
+
+	Context("when the plugin fails without a CNI error", func() {
+		var tmpDir string
+
+		BeforeEach(func() {
+			if runtime.GOOS == "windows" {
+				Skip("test plugins are shell scripts")
+			}
+
+			var err error
+			tmpDir, err = ioutil.TempDir("", "cni_raw_exec")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		writePlugin := func(script string) string {
+			pluginPath := filepath.Join(tmpDir, "failing-plugin")
+			Expect(ioutil.WriteFile(pluginPath, []byte("#!/bin/sh\n"+script), 0700)).To(Succeed())
+			return pluginPath
+		}
+
+		It("returns the exit code and the end of stderr", func() {
+			pluginPath := writePlugin("echo 'panic: something broke' >&2; exit 3")
+			stderrBuffer := &bytes.Buffer{}
+			execer.Stderr = stderrBuffer
+			execer.StderrTailSize = 16
+
+			_, err := execer.ExecPlugin(ctx, pluginPath, stdin, environ)
+			Expect(err).To(Equal(&types.Error{
+				Msg:     "netplugin failed with no error message",
+				Details: `exit code 3; stderr: "something broke\n"`,
+			}))
+			Expect(err).To(MatchError(`netplugin failed with no error message; exit code 3; stderr: "something broke\n"`))
+			Expect(stderrBuffer.String()).To(Equal("panic: something broke\n"))
+		})
+
+		It("returns the signal that killed the plugin", func() {
+			pluginPath := writePlugin("kill -SEGV $$")
+
+			_, err := execer.ExecPlugin(ctx, pluginPath, stdin, environ)
+			Expect(err).To(BeAssignableToTypeOf(&types.Error{}))
+			Expect(err.(*types.Error).Details).To(Equal("killed by signal: segmentation fault"))
+		})
+
+		It("includes output that is not a CNI error", func() {
+			pluginPath := writePlugin("echo 'not json'; exit 1")
+
+			_, err := execer.ExecPlugin(ctx, pluginPath, stdin, environ)
+			Expect(err).To(BeAssignableToTypeOf(&types.Error{}))
+			Expect(err).To(MatchError(ContainSubstring(`netplugin failed but error parsing its diagnostic message "not json\n"`)))
+		})
+	})
+
+	Context("when the context expires while the plugin runs", func() {
+		var (
+			tmpDir     string
+			pluginPath string
+		)
+
+		BeforeEach(func() {
+			if runtime.GOOS != "linux" {
+				Skip("test relies on /proc")
+			}
+
+			var err error
+			tmpDir, err = ioutil.TempDir("", "cni_raw_exec")
+			Expect(err).NotTo(HaveOccurred())
+
+			// Forks a helper, records it, and records SIGTERM if it arrives
+			pluginPath = filepath.Join(tmpDir, "forking-plugin")
+			script := fmt.Sprintf(`#!/bin/sh
+sleep 60 &
+echo $! > %[1]s/helper.pid
+trap 'echo term > %[1]s/terminated; exit 1' TERM
+wait
+`, tmpDir)
+			Expect(ioutil.WriteFile(pluginPath, []byte(script), 0700)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		helperAlive := func() bool {
+			pidBytes, err := ioutil.ReadFile(filepath.Join(tmpDir, "helper.pid"))
+			Expect(err).NotTo(HaveOccurred())
+			stat, err := ioutil.ReadFile(filepath.Join("/proc", strings.TrimSpace(string(pidBytes)), "stat"))
+			if os.IsNotExist(err) {
+				return false
+			}
+			Expect(err).NotTo(HaveOccurred())
+			// Killed helpers are reparented, and may linger as zombies
+			// until their new parent reaps them
+			fields := strings.Fields(string(stat))
+			return fields[2] != "Z"
+		}
+
+		It("kills the plugin and its helpers and returns a KilledError", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			_, err := execer.ExecPlugin(ctx, pluginPath, stdin, environ)
+			Expect(err).To(Equal(&invoke.KilledError{Plugin: pluginPath, Err: context.DeadlineExceeded}))
+			Eventually(helperAlive).Should(BeFalse())
+			Expect(filepath.Join(tmpDir, "terminated")).NotTo(BeAnExistingFile())
+		})
+
+		It("sends SIGTERM first when a grace period is set", func() {
+			execer.GracePeriod = 10 * time.Second
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			_, err := execer.ExecPlugin(ctx, pluginPath, stdin, environ)
+			Expect(err).To(BeAssignableToTypeOf(&invoke.KilledError{}))
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+			Expect(filepath.Join(tmpDir, "terminated")).To(BeAnExistingFile())
+			Eventually(helperAlive).Should(BeFalse())
+		})
+	})
+
 	Context("when the system is unable to execute the plugin", func() {
 		It("returns the error", func() {
 			_, err := execer.ExecPlugin(ctx, "/tmp/some/invalid/plugin/path", stdin, environ)
@@ -0,0 +1,262 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/version"
+)
+
+// maxRecordedLineSize is the longest fixture line ReplayExec accepts
+const maxRecordedLineSize = 16 << 20
+
+// RecordedInvocation is one plugin invocation in a fixture written by
+// RecordingExec and read by ReplayExec. Fixtures hold one JSON-encoded
+// RecordedInvocation per line, in the order the plugins were executed.
+type RecordedInvocation struct {
+	// Plugin is the file name of the plugin, without its directory, so
+	// that fixtures can be replayed with a different CNI_PATH
+	Plugin string `json:"plugin"`
+	Stdin  string `json:"stdin"`
+	// Env holds the CNI_ variables the plugin was run with. The rest of
+	// the environment is inherited from the host and not recorded.
+	Env    []string `json:"env"`
+	Stdout string   `json:"stdout,omitempty"`
+	// Error is set if the plugin failed with a CNI error
+	Error *types.Error `json:"error,omitempty"`
+	// ErrorMsg is set if the plugin failed with any other error
+	ErrorMsg string `json:"errorMsg,omitempty"`
+}
+
+// RecordingExec is an Exec that records every plugin invocation made
+// through the Exec it wraps to a fixture, for later use with ReplayExec
+type RecordingExec struct {
+	Exec
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRecordingExec returns a RecordingExec writing the invocations made
+// through exec to w. If exec is nil, plugins are executed as usual.
+func NewRecordingExec(exec Exec, w io.Writer) *RecordingExec {
+	if exec == nil {
+		exec = defaultExec
+	}
+	return &RecordingExec{Exec: exec, w: w}
+}
+
+func (e *RecordingExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	stdout, err := e.Exec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+
+	rec := &RecordedInvocation{
+		Plugin: filepath.Base(pluginPath),
+		Stdin:  string(stdinData),
+		Env:    cniEnv(environ),
+		Stdout: string(stdout),
+	}
+	if err != nil {
+		if cniErr, ok := err.(*types.Error); ok {
+			rec.Error = cniErr
+		} else {
+			rec.ErrorMsg = err.Error()
+		}
+	}
+
+	data, merr := json.Marshal(rec)
+	if merr != nil {
+		return nil, fmt.Errorf("failed to record invocation of %s: %v", pluginPath, merr)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, werr := e.w.Write(append(data, '\n')); werr != nil {
+		return nil, fmt.Errorf("failed to record invocation of %s: %v", pluginPath, werr)
+	}
+	return stdout, err
+}
+
+// UnexpectedInvocationError is returned by ReplayExec when a plugin
+// invocation does not match the next one in its fixture
+type UnexpectedInvocationError struct {
+	Plugin  string
+	Command string
+	// Reason describes how the invocation differs from the recorded one
+	Reason string
+}
+
+func (e *UnexpectedInvocationError) Error() string {
+	return fmt.Sprintf("unexpected %s invocation of plugin %s: %s", e.Command, e.Plugin, e.Reason)
+}
+
+// ReplayExec is an Exec that never executes a plugin. It serves the
+// responses recorded in a fixture instead, requiring plugins to be invoked
+// in the recorded order with the recorded stdin and CNI_ variables.
+// CNI_PATH is not compared.
+type ReplayExec struct {
+	version.PluginDecoder
+
+	mu          sync.Mutex
+	invocations []*RecordedInvocation
+	next        int
+}
+
+// NewReplayExec reads a fixture written by RecordingExec from r
+func NewReplayExec(r io.Reader) (*ReplayExec, error) {
+	e := &ReplayExec{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxRecordedLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		rec := &RecordedInvocation{}
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			return nil, fmt.Errorf("failed to parse recorded invocation on line %d: %v", line, err)
+		}
+		e.invocations = append(e.invocations, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recorded invocations: %v", err)
+	}
+	return e, nil
+}
+
+func (e *ReplayExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	plugin := filepath.Base(pluginPath)
+	env := cniEnv(environ)
+	unexpected := func(format string, a ...interface{}) error {
+		return &UnexpectedInvocationError{
+			Plugin:  plugin,
+			Command: envValue(env, "CNI_COMMAND"),
+			Reason:  fmt.Sprintf(format, a...),
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.next >= len(e.invocations) {
+		return nil, unexpected("all %d recorded invocations were replayed", len(e.invocations))
+	}
+	rec := e.invocations[e.next]
+
+	if rec.Plugin != plugin {
+		return nil, unexpected("expected plugin %s", rec.Plugin)
+	}
+	if !equalEnv(rec.Env, env) {
+		return nil, unexpected("expected environment %v, got %v", rec.Env, env)
+	}
+	if !equalStdin([]byte(rec.Stdin), stdinData) {
+		return nil, unexpected("expected stdin %s, got %s", rec.Stdin, stdinData)
+	}
+
+	e.next++
+	if rec.Error != nil {
+		// Callers may hold on to the error, so hand each one its own copy
+		cniErr := *rec.Error
+		return nil, &cniErr
+	}
+	if rec.ErrorMsg != "" {
+		return nil, errors.New(rec.ErrorMsg)
+	}
+	return []byte(rec.Stdout), nil
+}
+
+// FindInPath finds plugins that were recorded in the fixture, as if they
+// were in the first of the paths
+func (e *ReplayExec) FindInPath(plugin string, paths []string) (string, error) {
+	if plugin == "" {
+		return "", fmt.Errorf("no plugin name provided")
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("no paths provided")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, rec := range e.invocations {
+		if strings.TrimSuffix(rec.Plugin, filepath.Ext(rec.Plugin)) == plugin {
+			return filepath.Join(paths[0], rec.Plugin), nil
+		}
+	}
+	return "", fmt.Errorf("failed to find plugin %q in path %s", plugin, paths)
+}
+
+// Remaining returns the number of recorded invocations not yet replayed.
+// Tests can check it is zero to make sure every invocation was made.
+func (e *ReplayExec) Remaining() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.invocations) - e.next
+}
+
+// cniEnv returns the CNI_ variables of environ, sorted
+func cniEnv(environ []string) []string {
+	env := []string{}
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, "CNI_") {
+			env = append(env, kv)
+		}
+	}
+	sort.Strings(env)
+	return env
+}
+
+func envValue(env []string, key string) string {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, key+"=") {
+			return kv[len(key)+1:]
+		}
+	}
+	return ""
+}
+
+// equalEnv compares the CNI_ variables of two invocations, ignoring CNI_PATH
+func equalEnv(recorded, env []string) bool {
+	strip := func(env []string) []string {
+		stripped := []string{}
+		for _, kv := range env {
+			if !strings.HasPrefix(kv, "CNI_PATH=") {
+				stripped = append(stripped, kv)
+			}
+		}
+		return stripped
+	}
+	return reflect.DeepEqual(strip(recorded), strip(env))
+}
+
+// equalStdin compares two network configurations as JSON, so that key
+// order does not matter, or byte for byte if either is not JSON
+func equalStdin(recorded, stdin []byte) bool {
+	var a, b interface{}
+	if json.Unmarshal(recorded, &a) != nil || json.Unmarshal(stdin, &b) != nil {
+		return bytes.Equal(recorded, stdin)
+	}
+	return reflect.DeepEqual(a, b)
+}
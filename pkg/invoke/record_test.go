@@ -0,0 +1,162 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/types"
+	noop_debug "github.com/containernetworking/cni/plugins/test/noop/debug"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recording and replaying plugin invocations", func() {
+	var (
+		debugFileName string
+		fixture       *bytes.Buffer
+		recorder      *invoke.RecordingExec
+		args          *invoke.Args
+		ctx           context.Context
+	)
+
+	const (
+		netconf      = `{"name": "recordtest", "cniVersion": "0.4.0", "type": "noop"}`
+		reportResult = `{"cniVersion": "0.4.0", "ips": [{"version": "4", "address": "10.1.2.3/24"}], "dns": {}}`
+	)
+
+	BeforeEach(func() {
+		debugFile, err := ioutil.TempFile("", "cni_debug")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(debugFile.Close()).To(Succeed())
+		debugFileName = debugFile.Name()
+
+		debug := &noop_debug.Debug{ReportResult: reportResult}
+		Expect(debug.WriteDebug(debugFileName)).To(Succeed())
+
+		fixture = &bytes.Buffer{}
+		recorder = invoke.NewRecordingExec(nil, fixture)
+		args = &invoke.Args{
+			Command:     "ADD",
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns/path",
+			PluginArgs:  [][2]string{{"DEBUG", debugFileName}},
+			IfName:      "eth0",
+			Path:        filepath.Dir(pathToPlugin),
+		}
+		ctx = context.TODO()
+	})
+
+	AfterEach(func() {
+		Expect(os.Remove(debugFileName)).To(Succeed())
+	})
+
+	It("records each invocation as a line of JSON", func() {
+		_, err := invoke.ExecPluginWithResult(ctx, pathToPlugin, []byte(netconf), args, recorder)
+		Expect(err).NotTo(HaveOccurred())
+
+		lines := strings.Split(strings.TrimSpace(fixture.String()), "\n")
+		Expect(lines).To(HaveLen(1))
+
+		rec := &invoke.RecordedInvocation{}
+		Expect(json.Unmarshal([]byte(lines[0]), rec)).To(Succeed())
+		Expect(rec.Plugin).To(Equal(filepath.Base(pathToPlugin)))
+		Expect(rec.Stdin).To(MatchJSON(netconf))
+		Expect(rec.Env).To(ContainElement("CNI_COMMAND=ADD"))
+		Expect(rec.Env).To(ContainElement("CNI_IFNAME=eth0"))
+		for _, kv := range rec.Env {
+			Expect(kv).To(HavePrefix("CNI_"))
+		}
+		Expect(rec.Stdout).To(MatchJSON(reportResult))
+		Expect(rec.Error).To(BeNil())
+	})
+
+	It("replays recorded results and errors without executing plugins", func() {
+		_, err := invoke.ExecPluginWithResult(ctx, pathToPlugin, []byte(netconf), args, recorder)
+		Expect(err).NotTo(HaveOccurred())
+
+		debug := &noop_debug.Debug{ReportError: "banana"}
+		Expect(debug.WriteDebug(debugFileName)).To(Succeed())
+		args.Command = "DEL"
+		recordedErr := invoke.ExecPluginWithoutResult(ctx, pathToPlugin, []byte(netconf), args, recorder)
+		Expect(recordedErr).To(HaveOccurred())
+
+		// The plugins are gone, only the fixture is left
+		Expect(os.Remove(debugFileName)).To(Succeed())
+		replayer, err := invoke.NewReplayExec(fixture)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replayer.Remaining()).To(Equal(2))
+
+		pluginPath, err := replayer.FindInPath(filepath.Base(pathToPlugin), []string{"/other/path"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pluginPath).To(Equal(filepath.Join("/other/path", filepath.Base(pathToPlugin))))
+		args.Path = "/other/path"
+
+		args.Command = "ADD"
+		result, err := invoke.ExecPluginWithResult(ctx, pluginPath, []byte(netconf), args, replayer)
+		Expect(err).NotTo(HaveOccurred())
+		resultJSON, err := json.Marshal(result)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resultJSON).To(MatchJSON(reportResult))
+
+		args.Command = "DEL"
+		err = invoke.ExecPluginWithoutResult(ctx, pluginPath, []byte(netconf), args, replayer)
+		Expect(err).To(BeAssignableToTypeOf(&types.Error{}))
+		Expect(err).To(Equal(recordedErr))
+		Expect(replayer.Remaining()).To(Equal(0))
+
+		// Recreate the debug file for AfterEach
+		Expect(debug.WriteDebug(debugFileName)).To(Succeed())
+	})
+
+	It("fails on invocations that were not recorded", func() {
+		_, err := invoke.ExecPluginWithResult(ctx, pathToPlugin, []byte(netconf), args, recorder)
+		Expect(err).NotTo(HaveOccurred())
+
+		replayer, err := invoke.NewReplayExec(bytes.NewReader(fixture.Bytes()))
+		Expect(err).NotTo(HaveOccurred())
+
+		By("changing the arguments")
+		args.IfName = "eth1"
+		_, err = invoke.ExecPluginWithResult(ctx, pathToPlugin, []byte(netconf), args, replayer)
+		Expect(err).To(BeAssignableToTypeOf(&invoke.UnexpectedInvocationError{}))
+		Expect(err.Error()).To(HavePrefix("unexpected ADD invocation of plugin noop: expected environment"))
+		args.IfName = "eth0"
+
+		By("changing the configuration")
+		_, err = invoke.ExecPluginWithResult(ctx, pathToPlugin, []byte(`{"cniVersion": "0.4.0", "type": "noop"}`), args, replayer)
+		Expect(err).To(BeAssignableToTypeOf(&invoke.UnexpectedInvocationError{}))
+		Expect(err.Error()).To(ContainSubstring("expected stdin"))
+
+		By("matching regardless of key order")
+		_, err = invoke.ExecPluginWithResult(ctx, pathToPlugin, []byte(`{"type": "noop", "cniVersion": "0.4.0", "name": "recordtest"}`), args, replayer)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("invoking once more than recorded")
+		_, err = invoke.ExecPluginWithResult(ctx, pathToPlugin, []byte(netconf), args, replayer)
+		Expect(err).To(MatchError("unexpected ADD invocation of plugin noop: all 1 recorded invocations were replayed"))
+
+		_, err = replayer.FindInPath("bridge", []string{"/some/path"})
+		Expect(err).To(HaveOccurred())
+	})
+})
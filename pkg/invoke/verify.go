@@ -0,0 +1,138 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PluginVerifier decides whether a plugin binary may be executed
+type PluginVerifier interface {
+	// Verify is given the name of the plugin, without any executable file
+	// extension, its path and the hex-encoded SHA-256 digest of its binary
+	Verify(plugin, pluginPath, digest string) error
+}
+
+// UnsafePermissionsError is returned by VerifyingExec when a plugin, or a
+// directory it is in, can be written to by any user
+type UnsafePermissionsError struct {
+	Plugin string
+	// Path is the world-writable file or directory
+	Path string
+	Mode os.FileMode
+}
+
+func (e *UnsafePermissionsError) Error() string {
+	return fmt.Sprintf("refusing to execute plugin %s: %s is world-writable (%v)", e.Plugin, e.Path, e.Mode)
+}
+
+// DigestMismatchError is returned by DigestAllowlist when the digest of a
+// plugin is not one of those allowed for it
+type DigestMismatchError struct {
+	Plugin string
+	Path   string
+	Digest string
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("refusing to execute plugin %s: %s has unknown digest sha256:%s", e.Plugin, e.Path, e.Digest)
+}
+
+// DigestAllowlist is a PluginVerifier that maps plugin names to the
+// hex-encoded SHA-256 digests of the binaries allowed for them. Plugins
+// that are not listed are refused.
+type DigestAllowlist map[string][]string
+
+func (l DigestAllowlist) Verify(plugin, pluginPath, digest string) error {
+	for _, allowed := range l[plugin] {
+		if strings.EqualFold(allowed, digest) {
+			return nil
+		}
+	}
+	return &DigestMismatchError{Plugin: plugin, Path: pluginPath, Digest: digest}
+}
+
+// VerifyingExec is an Exec that checks a plugin binary before executing
+// it. Plugins that are world-writable, or are in a world-writable
+// directory without the sticky bit, are refused, and the others must be
+// accepted by Verifier. This prevents a writable directory early in
+// CNI_PATH from silently shadowing a plugin.
+//
+// The binary is verified and then executed by its path, so a binary that is
+// replaced between the two is executed unverified. The permission checks
+// are what keep other users from doing so; VerifyingExec does not protect
+// against users who may write to the plugin directories.
+type VerifyingExec struct {
+	Exec
+	Verifier PluginVerifier
+}
+
+// NewVerifyingExec returns a VerifyingExec that verifies plugins before
+// executing them with exec. If exec is nil, they are executed as usual.
+func NewVerifyingExec(exec Exec, verifier PluginVerifier) *VerifyingExec {
+	if exec == nil {
+		exec = defaultExec
+	}
+	return &VerifyingExec{Exec: exec, Verifier: verifier}
+}
+
+func (e *VerifyingExec) ExecPlugin(ctx context.Context, pluginPath string, stdinData []byte, environ []string) ([]byte, error) {
+	if err := e.verify(pluginPath); err != nil {
+		return nil, err
+	}
+	return e.Exec.ExecPlugin(ctx, pluginPath, stdinData, environ)
+}
+
+func (e *VerifyingExec) verify(pluginPath string) error {
+	plugin := filepath.Base(pluginPath)
+	for _, ext := range ExecutableFileExtensions {
+		if ext != "" && strings.HasSuffix(plugin, ext) {
+			plugin = strings.TrimSuffix(plugin, ext)
+			break
+		}
+	}
+
+	if err := checkPermissions(plugin, pluginPath); err != nil {
+		return err
+	}
+
+	digest, err := fileDigest(pluginPath)
+	if err != nil {
+		return fmt.Errorf("failed to verify plugin %s: %v", plugin, err)
+	}
+	return e.Verifier.Verify(plugin, pluginPath, digest)
+}
+
+// fileDigest returns the hex-encoded SHA-256 digest of a file
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
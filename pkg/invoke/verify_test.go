@@ -0,0 +1,125 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package invoke_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	noop_debug "github.com/containernetworking/cni/plugins/test/noop/debug"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Verifying plugins", func() {
+	var (
+		tmpDir        string
+		pluginDir     string
+		pluginPath    string
+		digest        string
+		debugFileName string
+		args          *invoke.Args
+		ctx           context.Context
+	)
+
+	const netconf = `{"name": "verifytest", "cniVersion": "0.4.0", "type": "noop"}`
+
+	BeforeEach(func() {
+		if runtime.GOOS == "windows" {
+			Skip("file permissions are not checked on Windows")
+		}
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cni_verify")
+		Expect(err).NotTo(HaveOccurred())
+
+		pluginDir = filepath.Join(tmpDir, "bin")
+		Expect(os.Mkdir(pluginDir, 0755)).To(Succeed())
+		pluginBytes, err := ioutil.ReadFile(pathToPlugin)
+		Expect(err).NotTo(HaveOccurred())
+		pluginPath = filepath.Join(pluginDir, "noop")
+		Expect(ioutil.WriteFile(pluginPath, pluginBytes, 0755)).To(Succeed())
+		sum := sha256.Sum256(pluginBytes)
+		digest = hex.EncodeToString(sum[:])
+
+		debugFileName = filepath.Join(tmpDir, "debug")
+		debug := &noop_debug.Debug{ReportResult: `{"cniVersion": "0.4.0"}`}
+		Expect(debug.WriteDebug(debugFileName)).To(Succeed())
+
+		args = &invoke.Args{
+			Command:     "ADD",
+			ContainerID: "some-container-id",
+			NetNS:       "/some/netns/path",
+			PluginArgs:  [][2]string{{"DEBUG", debugFileName}},
+			IfName:      "eth0",
+			Path:        pluginDir,
+		}
+		ctx = context.TODO()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	executed := func() bool {
+		debug, err := noop_debug.ReadDebug(debugFileName)
+		Expect(err).NotTo(HaveOccurred())
+		return debug.Command != ""
+	}
+
+	It("executes plugins with an allowed digest", func() {
+		execer := invoke.NewVerifyingExec(nil, invoke.DigestAllowlist{"noop": {"0000", digest}})
+		_, err := invoke.ExecPluginWithResult(ctx, pluginPath, []byte(netconf), args, execer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(executed()).To(BeTrue())
+	})
+
+	It("refuses plugins with another digest", func() {
+		execer := invoke.NewVerifyingExec(nil, invoke.DigestAllowlist{"noop": {"0000"}, "other": {digest}})
+		_, err := invoke.ExecPluginWithResult(ctx, pluginPath, []byte(netconf), args, execer)
+		Expect(err).To(Equal(&invoke.DigestMismatchError{Plugin: "noop", Path: pluginPath, Digest: digest}))
+		Expect(err.Error()).To(Equal("refusing to execute plugin noop: " + pluginPath + " has unknown digest sha256:" + digest))
+		Expect(executed()).To(BeFalse())
+	})
+
+	It("refuses world-writable plugins and directories", func() {
+		execer := invoke.NewVerifyingExec(nil, invoke.DigestAllowlist{"noop": {digest}})
+
+		Expect(os.Chmod(pluginPath, 0777)).To(Succeed())
+		_, err := invoke.ExecPluginWithResult(ctx, pluginPath, []byte(netconf), args, execer)
+		Expect(err).To(BeAssignableToTypeOf(&invoke.UnsafePermissionsError{}))
+		Expect(err.(*invoke.UnsafePermissionsError).Path).To(Equal(pluginPath))
+		Expect(os.Chmod(pluginPath, 0755)).To(Succeed())
+
+		Expect(os.Chmod(pluginDir, 0777)).To(Succeed())
+		_, err = invoke.ExecPluginWithResult(ctx, pluginPath, []byte(netconf), args, execer)
+		Expect(err).To(BeAssignableToTypeOf(&invoke.UnsafePermissionsError{}))
+		Expect(err.(*invoke.UnsafePermissionsError).Path).To(Equal(pluginDir))
+		Expect(executed()).To(BeFalse())
+
+		By("allowing world-writable directories with the sticky bit")
+		Expect(os.Chmod(pluginDir, 0777|os.ModeSticky)).To(Succeed())
+		_, err = invoke.ExecPluginWithResult(ctx, pluginPath, []byte(netconf), args, execer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(executed()).To(BeTrue())
+	})
+})
@@ -0,0 +1,53 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package invoke
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// checkPermissions refuses plugins that are world-writable, or that are in
+// a world-writable directory in which anyone could replace them. Directories
+// with the sticky bit, like /tmp, only let owners replace their entries.
+func checkPermissions(plugin, pluginPath string) error {
+	path, err := filepath.Abs(pluginPath)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Perm()&0002 != 0 {
+		return &UnsafePermissionsError{Plugin: plugin, Path: path, Mode: fi.Mode()}
+	}
+
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if fi.Mode().Perm()&0002 != 0 && fi.Mode()&os.ModeSticky == 0 {
+			return &UnsafePermissionsError{Plugin: plugin, Path: dir, Mode: fi.Mode()}
+		}
+		if dir == filepath.Dir(dir) {
+			return nil
+		}
+	}
+}
@@ -40,6 +40,18 @@ type CmdArgs struct {
 	Args        string
 	Path        string
 	StdinData   []byte
+
+	// stdout is where plugins run by PluginMainWithIO write their result
+	stdout io.Writer
+}
+
+// Stdout returns where the plugin must print its result. It is os.Stdout,
+// unless the plugin was run in-process by PluginMainWithIO.
+func (args *CmdArgs) Stdout() io.Writer {
+	if args.stdout == nil {
+		return os.Stdout
+	}
+	return args.stdout
 }
 
 type dispatcher struct {
@@ -50,6 +62,10 @@ type dispatcher struct {
 
 	ConfVersionDecoder version.ConfigDecoder
 	VersionReconciler  version.Reconciler
+
+	// passStdout hands Stdout to the callbacks through CmdArgs, for
+	// plugins that do not own the process's stdout
+	passStdout bool
 }
 
 type reqForCmdEntry map[string]bool
@@ -66,54 +82,66 @@ func (t *dispatcher) getCmdArgsFromEnv() (string, *CmdArgs, *types.Error) {
 			"CNI_COMMAND",
 			&cmd,
 			reqForCmdEntry{
-				"ADD":   true,
-				"CHECK": true,
-				"DEL":   true,
+				"ADD":    true,
+				"CHECK":  true,
+				"DEL":    true,
+				"GC":     true,
+				"STATUS": true,
 			},
 		},
 		{
 			"CNI_CONTAINERID",
 			&contID,
 			reqForCmdEntry{
-				"ADD":   true,
-				"CHECK": true,
-				"DEL":   true,
+				"ADD":    true,
+				"CHECK":  true,
+				"DEL":    true,
+				"GC":     false,
+				"STATUS": false,
 			},
 		},
 		{
 			"CNI_NETNS",
 			&netns,
 			reqForCmdEntry{
-				"ADD":   true,
-				"CHECK": true,
-				"DEL":   false,
+				"ADD":    true,
+				"CHECK":  true,
+				"DEL":    false,
+				"GC":     false,
+				"STATUS": false,
 			},
 		},
 		{
 			"CNI_IFNAME",
 			&ifName,
 			reqForCmdEntry{
-				"ADD":   true,
-				"CHECK": true,
-				"DEL":   true,
+				"ADD":    true,
+				"CHECK":  true,
+				"DEL":    true,
+				"GC":     false,
+				"STATUS": false,
 			},
 		},
 		{
 			"CNI_ARGS",
 			&args,
 			reqForCmdEntry{
-				"ADD":   false,
-				"CHECK": false,
-				"DEL":   false,
+				"ADD":    false,
+				"CHECK":  false,
+				"DEL":    false,
+				"GC":     false,
+				"STATUS": false,
 			},
 		},
 		{
 			"CNI_PATH",
 			&path,
 			reqForCmdEntry{
-				"ADD":   true,
-				"CHECK": true,
-				"DEL":   true,
+				"ADD":    true,
+				"CHECK":  true,
+				"DEL":    true,
+				"GC":     true,
+				"STATUS": true,
 			},
 		},
 	}
@@ -150,6 +178,9 @@ func (t *dispatcher) getCmdArgsFromEnv() (string, *CmdArgs, *types.Error) {
 		Path:        path,
 		StdinData:   stdinData,
 	}
+	if t.passStdout {
+		cmdArgs.stdout = t.Stdout
+	}
 	return cmd, cmdArgs, nil
 }
 
@@ -190,7 +221,26 @@ func validateConfig(jsonBytes []byte) *types.Error {
 	return nil
 }
 
-func (t *dispatcher) pluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error, versionInfo version.PluginInfo, about string) *types.Error {
+// CNIFuncs contains a group of callback command funcs to be passed in as
+// parameters to the core "main" for a plugin.
+type CNIFuncs struct {
+	Add   func(_ *CmdArgs) error
+	Del   func(_ *CmdArgs) error
+	Check func(_ *CmdArgs) error
+	// GC is called with the network configuration, which lists the
+	// attachments that are still valid under the
+	// "cni.dev/valid-attachments" key. The plugin should release any
+	// resources it holds for other attachments. If GC is nil, the GC
+	// command succeeds without doing anything.
+	GC func(_ *CmdArgs) error
+	// Status is called with the network configuration to find out whether
+	// the plugin is ready to service ADD requests. It should return an
+	// error, such as types.ErrPluginNotAvailable, if it is not. If Status
+	// is nil, the plugin is always ready.
+	Status func(_ *CmdArgs) error
+}
+
+func (t *dispatcher) pluginMain(funcs CNIFuncs, versionInfo version.PluginInfo, about string) *types.Error {
 	cmd, cmdArgs, err := t.getCmdArgsFromEnv()
 	if err != nil {
 		// Print the about string to stderr when no command is set
@@ -205,6 +255,9 @@ func (t *dispatcher) pluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error,
 		if err = validateConfig(cmdArgs.StdinData); err != nil {
 			return err
 		}
+	}
+	// GC and STATUS are not about a single container
+	if cmd != "VERSION" && cmd != "GC" && cmd != "STATUS" {
 		if err = utils.ValidateContainerID(cmdArgs.ContainerID); err != nil {
 			return err
 		}
@@ -215,7 +268,7 @@ func (t *dispatcher) pluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error,
 
 	switch cmd {
 	case "ADD":
-		err = t.checkVersionAndCall(cmdArgs, versionInfo, cmdAdd)
+		err = t.checkVersionAndCall(cmdArgs, versionInfo, funcs.Add)
 	case "CHECK":
 		configVersion, err := t.ConfVersionDecoder.Decode(cmdArgs.StdinData)
 		if err != nil {
@@ -231,7 +284,7 @@ func (t *dispatcher) pluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error,
 			if err != nil {
 				return types.NewError(types.ErrDecodingFailure, err.Error(), "")
 			} else if gtet {
-				if err := t.checkVersionAndCall(cmdArgs, versionInfo, cmdCheck); err != nil {
+				if err := t.checkVersionAndCall(cmdArgs, versionInfo, funcs.Check); err != nil {
 					return err
 				}
 				return nil
@@ -239,7 +292,15 @@ func (t *dispatcher) pluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error,
 		}
 		return types.NewError(types.ErrIncompatibleCNIVersion, "plugin version does not allow CHECK", "")
 	case "DEL":
-		err = t.checkVersionAndCall(cmdArgs, versionInfo, cmdDel)
+		err = t.checkVersionAndCall(cmdArgs, versionInfo, funcs.Del)
+	case "GC":
+		if funcs.GC != nil {
+			err = t.checkVersionAndCall(cmdArgs, versionInfo, funcs.GC)
+		}
+	case "STATUS":
+		if funcs.Status != nil {
+			err = t.checkVersionAndCall(cmdArgs, versionInfo, funcs.Status)
+		}
 	case "VERSION":
 		if err := versionInfo.Encode(t.Stdout); err != nil {
 			return types.NewError(types.ErrIOFailure, err.Error(), "")
@@ -254,8 +315,8 @@ func (t *dispatcher) pluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error,
 	return nil
 }
 
-// PluginMainWithError is the core "main" for a plugin. It accepts
-// callback functions for add, check, and del CNI commands and returns an error.
+// PluginMainFuncsWithError is the core "main" for a plugin. It accepts
+// callback functions defined within CNIFuncs and returns an error.
 //
 // The caller must also specify what CNI spec versions the plugin supports.
 //
@@ -265,14 +326,73 @@ func (t *dispatcher) pluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error,
 // as JSON and then exit with nonzero status code.
 //
 // To let this package automatically handle errors and call os.Exit(1) for you,
-// use PluginMain() instead.
-func PluginMainWithError(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error, versionInfo version.PluginInfo, about string) *types.Error {
+// use PluginMainFuncs() instead.
+func PluginMainFuncsWithError(funcs CNIFuncs, versionInfo version.PluginInfo, about string) *types.Error {
 	return (&dispatcher{
 		Getenv: os.Getenv,
 		Stdin:  os.Stdin,
 		Stdout: os.Stdout,
 		Stderr: os.Stderr,
-	}).pluginMain(cmdAdd, cmdCheck, cmdDel, versionInfo, about)
+	}).pluginMain(funcs, versionInfo, about)
+}
+
+// PluginMainFuncsWithIO is like PluginMainFuncsWithError, but runs the
+// plugin with the given environment and standard streams instead of the
+// process's, so that a plugin can be run in-process, concurrently with
+// others. The callbacks must print their result to CmdArgs.Stdout(). Errors
+// are returned, not printed to stdout.
+func PluginMainFuncsWithIO(getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer, funcs CNIFuncs, versionInfo version.PluginInfo, about string) *types.Error {
+	return (&dispatcher{
+		Getenv:     getenv,
+		Stdin:      stdin,
+		Stdout:     stdout,
+		Stderr:     stderr,
+		passStdout: true,
+	}).pluginMain(funcs, versionInfo, about)
+}
+
+// PluginMainFuncs is the core "main" for a plugin which includes automatic
+// error handling. It is like PluginMain, but takes the callbacks as
+// CNIFuncs, which also holds the callbacks of the newer commands, GC and
+// STATUS.
+//
+// When an error occurs in a callback, PluginMainFuncs will print the error
+// as JSON to stdout and call os.Exit(1).
+//
+// To have more control over error handling, use PluginMainFuncsWithError()
+// instead.
+func PluginMainFuncs(funcs CNIFuncs, versionInfo version.PluginInfo, about string) {
+	if e := PluginMainFuncsWithError(funcs, versionInfo, about); e != nil {
+		if err := e.Print(); err != nil {
+			log.Print("Error writing error JSON to stdout: ", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// PluginMainWithError is the core "main" for a plugin. It accepts
+// callback functions for add, check, and del CNI commands and returns an error.
+//
+// The caller must also specify what CNI spec versions the plugin supports.
+//
+// It is the responsibility of the caller to check for non-nil error return.
+//
+// For a plugin to comply with the CNI spec, it must print any error to stdout
+// as JSON and then exit with nonzero status code.
+//
+// To let this package automatically handle errors and call os.Exit(1) for you,
+// use PluginMain() instead.
+func PluginMainWithError(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error, versionInfo version.PluginInfo, about string) *types.Error {
+	return PluginMainFuncsWithError(CNIFuncs{Add: cmdAdd, Check: cmdCheck, Del: cmdDel}, versionInfo, about)
+}
+
+// PluginMainWithIO is like PluginMainWithError, but runs the plugin with
+// the given environment and standard streams instead of the process's, so
+// that a plugin can be run in-process, concurrently with others. The
+// callbacks must print their result to CmdArgs.Stdout(). Errors are
+// returned, not printed to stdout.
+func PluginMainWithIO(getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer, cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error, versionInfo version.PluginInfo, about string) *types.Error {
+	return PluginMainFuncsWithIO(getenv, stdin, stdout, stderr, CNIFuncs{Add: cmdAdd, Check: cmdCheck, Del: cmdDel}, versionInfo, about)
 }
 
 // PluginMain is the core "main" for a plugin which includes automatic error handling.
@@ -287,10 +407,5 @@ func PluginMainWithError(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error, versio
 //
 // To have more control over error handling, use PluginMainWithError() instead.
 func PluginMain(cmdAdd, cmdCheck, cmdDel func(_ *CmdArgs) error, versionInfo version.PluginInfo, about string) {
-	if e := PluginMainWithError(cmdAdd, cmdCheck, cmdDel, versionInfo, about); e != nil {
-		if err := e.Print(); err != nil {
-			log.Print("Error writing error JSON to stdout: ", err)
-		}
-		os.Exit(1)
-	}
+	PluginMainFuncs(CNIFuncs{Add: cmdAdd, Check: cmdCheck, Del: cmdDel}, versionInfo, about)
 }
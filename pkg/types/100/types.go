@@ -0,0 +1,297 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types100
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/types/020"
+	"github.com/containernetworking/cni/pkg/types/current"
+	"github.com/containernetworking/cni/pkg/types/internal/convert"
+)
+
+const ImplementedSpecVersion string = "1.0.0"
+
+// SupportedVersions also holds 1.1.0, which added the GC and STATUS commands
+// but left the result unchanged
+var SupportedVersions = []string{ImplementedSpecVersion, "1.1.0"}
+
+func init() {
+	// Results of 0.3.0 and later only differ from 1.0.0 in the IP version
+	// field, which 1.0.0 dropped, so they convert losslessly both ways
+	convert.RegisterConverter(current.SupportedVersions, SupportedVersions, convertFrom04x)
+
+	toVersions := append([]string{}, current.SupportedVersions...)
+	toVersions = append(toVersions, types020.SupportedVersions...)
+	convert.RegisterConverter(SupportedVersions, toVersions, convertTo04x)
+}
+
+func NewResult(data []byte) (types.Result, error) {
+	result := &Result{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func GetResult(r types.Result) (*Result, error) {
+	result100, err := r.GetAsVersion(ImplementedSpecVersion)
+	if err != nil {
+		return nil, err
+	}
+	result, ok := result100.(*Result)
+	if !ok {
+		return nil, fmt.Errorf("failed to convert result")
+	}
+	return result, nil
+}
+
+func NewResultFromResult(result types.Result) (*Result, error) {
+	return GetResult(result)
+}
+
+func convertFrom04x(from types.Result, toVersion string) (types.Result, error) {
+	fromResult, ok := from.(*current.Result)
+	if !ok {
+		return nil, fmt.Errorf("failed to convert result")
+	}
+
+	toResult := &Result{
+		CNIVersion: toVersion,
+		DNS:        copyDNS(fromResult.DNS),
+		Routes:     []*types.Route{},
+	}
+	for _, iface := range fromResult.Interfaces {
+		toResult.Interfaces = append(toResult.Interfaces, &Interface{
+			Name:    iface.Name,
+			Mac:     iface.Mac,
+			Sandbox: iface.Sandbox,
+		})
+	}
+	for _, ip := range fromResult.IPs {
+		toResult.IPs = append(toResult.IPs, &IPConfig{
+			Interface: copyInt(ip.Interface),
+			Address:   copyIPNet(ip.Address),
+			Gateway:   copyIP(ip.Gateway),
+		})
+	}
+	for _, route := range fromResult.Routes {
+		toResult.Routes = append(toResult.Routes, copyRoute(route))
+	}
+	return toResult, nil
+}
+
+func convertTo04x(from types.Result, toVersion string) (types.Result, error) {
+	fromResult, ok := from.(*Result)
+	if !ok {
+		return nil, fmt.Errorf("failed to convert result")
+	}
+
+	toResult := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		DNS:        copyDNS(fromResult.DNS),
+		Routes:     []*types.Route{},
+	}
+	for _, iface := range fromResult.Interfaces {
+		toResult.Interfaces = append(toResult.Interfaces, &current.Interface{
+			Name:    iface.Name,
+			Mac:     iface.Mac,
+			Sandbox: iface.Sandbox,
+		})
+	}
+	for i, ip := range fromResult.IPs {
+		var ipVersion string
+		if ip.Address.IP.To4() != nil {
+			ipVersion = "4"
+		} else if ip.Address.IP.To16() != nil {
+			ipVersion = "6"
+		} else {
+			return nil, fmt.Errorf("cannot convert: IP %d has no valid address", i)
+		}
+		toResult.IPs = append(toResult.IPs, &current.IPConfig{
+			Version:   ipVersion,
+			Interface: copyInt(ip.Interface),
+			Address:   copyIPNet(ip.Address),
+			Gateway:   copyIP(ip.Gateway),
+		})
+	}
+	for _, route := range fromResult.Routes {
+		toResult.Routes = append(toResult.Routes, copyRoute(route))
+	}
+
+	// Let the 0.4.0 result convert itself to older versions
+	return toResult.GetAsVersion(toVersion)
+}
+
+func copyInt(v *int) *int {
+	if v == nil {
+		return nil
+	}
+	return Int(*v)
+}
+
+func copyIP(ip net.IP) net.IP {
+	if ip == nil {
+		return nil
+	}
+	return append(net.IP{}, ip...)
+}
+
+func copyIPNet(ipn net.IPNet) net.IPNet {
+	ipn.IP = copyIP(ipn.IP)
+	if ipn.Mask != nil {
+		ipn.Mask = append(net.IPMask{}, ipn.Mask...)
+	}
+	return ipn
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
+func copyDNS(dns types.DNS) types.DNS {
+	return types.DNS{
+		Nameservers: copyStrings(dns.Nameservers),
+		Domain:      dns.Domain,
+		Search:      copyStrings(dns.Search),
+		Options:     copyStrings(dns.Options),
+	}
+}
+
+func copyRoute(route *types.Route) *types.Route {
+	return &types.Route{Dst: copyIPNet(route.Dst), GW: copyIP(route.GW)}
+}
+
+// Result is what gets returned from the plugin (via stdout) to the caller
+type Result struct {
+	CNIVersion string         `json:"cniVersion,omitempty"`
+	Interfaces []*Interface   `json:"interfaces,omitempty"`
+	IPs        []*IPConfig    `json:"ips,omitempty"`
+	Routes     []*types.Route `json:"routes,omitempty"`
+	DNS        types.DNS      `json:"dns,omitempty"`
+}
+
+func (r *Result) Version() string {
+	return ImplementedSpecVersion
+}
+
+func (r *Result) GetAsVersion(version string) (types.Result, error) {
+	for _, supportedVersion := range SupportedVersions {
+		if version == supportedVersion {
+			r.CNIVersion = version
+			return r, nil
+		}
+	}
+	if convertFn := convert.Find(ImplementedSpecVersion, version); convertFn != nil {
+		return convertFn(r, version)
+	}
+	return nil, fmt.Errorf("cannot convert version %s to %q", ImplementedSpecVersion, version)
+}
+
+func (r *Result) Print() error {
+	return r.PrintTo(os.Stdout)
+}
+
+func (r *Result) PrintTo(writer io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+// String returns a formatted string in the form of "[Interfaces: $1,][ IP: $2,] DNS: $3" where
+// $1 represents the receiver's Interfaces, $2 represents the receiver's IP addresses and $3 the
+// receiver's DNS. If $1 or $2 are nil, they won't be present in the returned string.
+func (r *Result) String() string {
+	var str string
+	if len(r.Interfaces) > 0 {
+		str += fmt.Sprintf("Interfaces:%+v, ", r.Interfaces)
+	}
+	if len(r.IPs) > 0 {
+		str += fmt.Sprintf("IP:%+v, ", r.IPs)
+	}
+	if len(r.Routes) > 0 {
+		str += fmt.Sprintf("Routes:%+v, ", r.Routes)
+	}
+	return fmt.Sprintf("%sDNS:%+v", str, r.DNS)
+}
+
+// Interface contains values about the created interfaces
+type Interface struct {
+	Name    string `json:"name"`
+	Mac     string `json:"mac,omitempty"`
+	Sandbox string `json:"sandbox,omitempty"`
+}
+
+func (i *Interface) String() string {
+	return fmt.Sprintf("%+v", *i)
+}
+
+// Int returns a pointer to the int value passed in.  Used to
+// set the IPConfig.Interface field.
+func Int(v int) *int {
+	return &v
+}
+
+// IPConfig contains values necessary to configure an IP address on an interface
+type IPConfig struct {
+	// Index into Result structs Interfaces list
+	Interface *int
+	Address   net.IPNet
+	Gateway   net.IP
+}
+
+func (i *IPConfig) String() string {
+	return fmt.Sprintf("%+v", *i)
+}
+
+// JSON (un)marshallable types
+type ipConfig struct {
+	Interface *int        `json:"interface,omitempty"`
+	Address   types.IPNet `json:"address"`
+	Gateway   net.IP      `json:"gateway,omitempty"`
+}
+
+func (c *IPConfig) MarshalJSON() ([]byte, error) {
+	ipc := ipConfig{
+		Interface: c.Interface,
+		Address:   types.IPNet(c.Address),
+		Gateway:   c.Gateway,
+	}
+
+	return json.Marshal(ipc)
+}
+
+func (c *IPConfig) UnmarshalJSON(data []byte) error {
+	ipc := ipConfig{}
+	if err := json.Unmarshal(data, &ipc); err != nil {
+		return err
+	}
+
+	c.Interface = ipc.Interface
+	c.Address = net.IPNet(ipc.Address)
+	c.Gateway = ipc.Gateway
+	return nil
+}
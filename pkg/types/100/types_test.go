@@ -0,0 +1,216 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types100_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/cni/pkg/types/020"
+	"github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/types/current"
+	"github.com/containernetworking/cni/pkg/version"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func testResult() *types100.Result {
+	ipv4, err := types.ParseCIDR("1.2.3.30/24")
+	Expect(err).NotTo(HaveOccurred())
+	ipv6, err := types.ParseCIDR("abcd:1234:ffff::cdde/64")
+	Expect(err).NotTo(HaveOccurred())
+	routegwv4, routev4, err := net.ParseCIDR("15.5.6.8/24")
+	Expect(err).NotTo(HaveOccurred())
+	routegwv6, routev6, err := net.ParseCIDR("1111:dddd::aaaa/80")
+	Expect(err).NotTo(HaveOccurred())
+
+	// Set every field of the struct to ensure source compatibility
+	return &types100.Result{
+		CNIVersion: "1.0.0",
+		Interfaces: []*types100.Interface{
+			{
+				Name:    "eth0",
+				Mac:     "00:11:22:33:44:55",
+				Sandbox: "/proc/3553/ns/net",
+			},
+		},
+		IPs: []*types100.IPConfig{
+			{
+				Interface: types100.Int(0),
+				Address:   *ipv4,
+				Gateway:   net.ParseIP("1.2.3.1"),
+			},
+			{
+				Interface: types100.Int(0),
+				Address:   *ipv6,
+				Gateway:   net.ParseIP("abcd:1234:ffff::1"),
+			},
+		},
+		Routes: []*types.Route{
+			{Dst: *routev4, GW: routegwv4},
+			{Dst: *routev6, GW: routegwv6},
+		},
+		DNS: types.DNS{
+			Nameservers: []string{"1.2.3.4", "1::cafe"},
+			Domain:      "acompany.com",
+			Search:      []string{"somedomain.com", "otherdomain.net"},
+			Options:     []string{"foo", "bar"},
+		},
+	}
+}
+
+var _ = Describe("1.0.0 types operations", func() {
+	It("correctly encodes a 1.0.0 Result without IP versions", func() {
+		out := &bytes.Buffer{}
+		Expect(testResult().PrintTo(out)).To(Succeed())
+
+		Expect(out.String()).To(MatchJSON(`{
+    "cniVersion": "1.0.0",
+    "interfaces": [
+        {
+            "name": "eth0",
+            "mac": "00:11:22:33:44:55",
+            "sandbox": "/proc/3553/ns/net"
+        }
+    ],
+    "ips": [
+        {
+            "interface": 0,
+            "address": "1.2.3.30/24",
+            "gateway": "1.2.3.1"
+        },
+        {
+            "interface": 0,
+            "address": "abcd:1234:ffff::cdde/64",
+            "gateway": "abcd:1234:ffff::1"
+        }
+    ],
+    "routes": [
+        {
+            "dst": "15.5.6.0/24",
+            "gw": "15.5.6.8"
+        },
+        {
+            "dst": "1111:dddd::/80",
+            "gw": "1111:dddd::aaaa"
+        }
+    ],
+    "dns": {
+        "nameservers": [
+            "1.2.3.4",
+            "1::cafe"
+        ],
+        "domain": "acompany.com",
+        "search": [
+            "somedomain.com",
+            "otherdomain.net"
+        ],
+        "options": [
+            "foo",
+            "bar"
+        ]
+    }
+}`))
+	})
+
+	It("converts to 0.4.0 and back without loss", func() {
+		res := testResult()
+
+		for _, v := range current.SupportedVersions {
+			converted, err := testResult().GetAsVersion(v)
+			Expect(err).NotTo(HaveOccurred())
+			result04x, ok := converted.(*current.Result)
+			Expect(ok).To(BeTrue())
+			Expect(result04x.CNIVersion).To(Equal(v))
+			Expect(result04x.IPs[0].Version).To(Equal("4"))
+			Expect(result04x.IPs[1].Version).To(Equal("6"))
+
+			back, err := result04x.GetAsVersion("1.0.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(back).To(Equal(res))
+		}
+	})
+
+	It("converts to 0.2.0", func() {
+		converted, err := testResult().GetAsVersion("0.2.0")
+		Expect(err).NotTo(HaveOccurred())
+		result020, ok := converted.(*types020.Result)
+		Expect(ok).To(BeTrue())
+		Expect(result020.IP4.IP.String()).To(Equal("1.2.3.30/24"))
+		Expect(result020.IP6.IP.String()).To(Equal("abcd:1234:ffff::cdde/64"))
+	})
+
+	It("does not share data with converted results", func() {
+		res := testResult()
+		converted, err := res.GetAsVersion("0.4.0")
+		Expect(err).NotTo(HaveOccurred())
+
+		converted.(*current.Result).IPs[0].Gateway[15] = 42
+		converted.(*current.Result).DNS.Nameservers[0] = "5.6.7.8"
+		Expect(res).To(Equal(testResult()))
+	})
+
+	It("is parsed by version.NewResult and current.GetResult", func() {
+		data, err := json.Marshal(testResult())
+		Expect(err).NotTo(HaveOccurred())
+
+		res, err := version.NewResult("1.0.0", data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(BeAssignableToTypeOf(&types100.Result{}))
+		Expect(json.Marshal(res)).To(MatchJSON(data))
+
+		result04x, err := current.GetResult(res)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result04x.CNIVersion).To(Equal("0.4.0"))
+		Expect(result04x.IPs).To(HaveLen(2))
+
+		result100, err := types100.GetResult(result04x)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Marshal(result100)).To(MatchJSON(data))
+	})
+
+	It("handles 1.1.0 results, which are unchanged from 1.0.0", func() {
+		data, err := json.Marshal(testResult())
+		Expect(err).NotTo(HaveOccurred())
+		res, err := version.NewResult("1.1.0", data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(BeAssignableToTypeOf(&types100.Result{}))
+
+		converted, err := res.GetAsVersion("1.1.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(converted.(*types100.Result).CNIVersion).To(Equal("1.1.0"))
+
+		result04x, err := testResult().GetAsVersion("0.4.0")
+		Expect(err).NotTo(HaveOccurred())
+		converted, err = result04x.GetAsVersion("1.1.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(converted.(*types100.Result).CNIVersion).To(Equal("1.1.0"))
+	})
+
+	It("refuses to convert IPs without a valid address", func() {
+		result := testResult()
+		result.IPs[1].Address = net.IPNet{}
+		_, err := result.GetAsVersion("0.4.0")
+		Expect(err).To(MatchError("cannot convert: IP 1 has no valid address"))
+	})
+
+	It("refuses unknown versions", func() {
+		_, err := testResult().GetAsVersion("2.0.0")
+		Expect(err).To(MatchError(`cannot convert version 1.0.0 to "2.0.0"`))
+	})
+})
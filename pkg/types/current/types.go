@@ -23,6 +23,7 @@ import (
 
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/types/020"
+	"github.com/containernetworking/cni/pkg/types/internal/convert"
 )
 
 const ImplementedSpecVersion string = "0.4.0"
@@ -118,7 +119,13 @@ func NewResultFromResult(result types.Result) (*Result, error) {
 			}
 		}
 	}
-	return nil, fmt.Errorf("unsupported CNI result22 version %q", version)
+	// Newer results know how to convert themselves
+	if newResult, err := result.GetAsVersion(ImplementedSpecVersion); err == nil {
+		if r, ok := newResult.(*Result); ok {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported CNI result version %q", version)
 }
 
 // Result is what gets returned from the plugin (via stdout) to the caller
@@ -191,6 +198,9 @@ func (r *Result) GetAsVersion(version string) (types.Result, error) {
 	case types020.SupportedVersions[0], types020.SupportedVersions[1], types020.SupportedVersions[2]:
 		return r.convertTo020()
 	}
+	if convertFn := convert.Find(ImplementedSpecVersion, version); convertFn != nil {
+		return convertFn(r, version)
+	}
 	return nil, fmt.Errorf("cannot convert version 0.3.x to %q", version)
 }
 
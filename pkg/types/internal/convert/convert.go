@@ -0,0 +1,64 @@
+// Copyright 2020 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package convert holds the conversions between the result types of
+// different CNI versions. Result packages register the conversions to and
+// from older versions, so that older packages can convert their results to
+// newer versions without importing the packages that implement them.
+package convert
+
+import (
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// ConvertFn converts a result to the given version
+type ConvertFn func(from types.Result, toVersion string) (types.Result, error)
+
+type converter struct {
+	fromVersions []string
+	toVersions   []string
+	convertFn    ConvertFn
+}
+
+var converters []*converter
+
+func contains(versions []string, version string) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the function that converts results of fromVersion to
+// toVersion, or nil if there is none
+func Find(fromVersion, toVersion string) ConvertFn {
+	for _, c := range converters {
+		if contains(c.fromVersions, fromVersion) && contains(c.toVersions, toVersion) {
+			return c.convertFn
+		}
+	}
+	return nil
+}
+
+// RegisterConverter registers a function that converts results of any of
+// fromVersions to any of toVersions. It must be called from init().
+func RegisterConverter(fromVersions, toVersions []string, convertFn ConvertFn) {
+	converters = append(converters, &converter{
+		fromVersions: fromVersions,
+		toVersions:   toVersions,
+		convertFn:    convertFn,
+	})
+}